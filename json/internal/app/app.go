@@ -1,38 +1,190 @@
 package app
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/zoumas/chirpy/json/internal/database"
 	"github.com/zoumas/chirpy/json/internal/env"
+	"github.com/zoumas/chirpy/json/internal/search"
 )
 
+// shutdownTimeout bounds how long Run waits for in-flight requests when shutting down.
+const shutdownTimeout = 10 * time.Second
+
 // App is used to implement stateful handlers. It groups global state.
 type App struct {
-	Env                     *env.Env
-	DB                      *database.DB
+	Env *env.Env
+	// DB is the JSON file database, or the in-memory database. It is nil when a different backend is used.
+	DB *database.DB
+	// SQLite is the SQLite database. It is nil when a different backend is used.
+	SQLite                  *sql.DB
 	ChirpRepository         database.ChirpRepository
 	UserRepository          database.UserRepository
 	RevokedTokensRepository database.RevokedTokensRepository
+	EventRepository         database.EventRepository
+	FollowRepository        database.FollowRepository
+	// SearchIndex indexes the chirps for full-text search. It is built when the App is created.
+	SearchIndex *search.Index
+
+	subscriptions []subscription
+	restoreHooks  []RestoreHook
+	// restoreMu is held for writing while the database is restored, and for reading while events are delivered.
+	restoreMu sync.RWMutex
+
+	// trending holds the trending hashtags, as computed by ComputeTrendingHashtags.
+	trendingMu sync.RWMutex
+	trending   []TrendingHashtag
 
 	// FileServerHits is used to count the number of times the website
 	// has been viewed since the server started.
 	FileServerHits int
 }
 
-func New(env *env.Env, db *database.DB) *App {
-	return &App{
-		Env:                     env,
-		DB:                      db,
-		ChirpRepository:         NewJSONChirpResository(db),
-		UserRepository:          NewJSONUserRepository(db),
-		RevokedTokensRepository: NewJSONRevokedTokensRepository(db),
+// New connects to the storage backend selected by the scheme of env.DSN
+// and wires the matching repositories.
+func New(env *env.Env) (*App, error) {
+	driver, path, err := database.ParseDSN(env.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &App{Env: env}
+
+	switch driver {
+	case database.DriverSQLite:
+		if env.ResetDB {
+			err := os.Remove(path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+
+		db, err := database.NewSQLite(path)
+		if err != nil {
+			return nil, err
+		}
+		app.SQLite = db
+		app.ChirpRepository = NewSQLiteChirpRepository(db)
+		app.UserRepository = NewSQLiteUserRepository(db)
+		app.RevokedTokensRepository = NewSQLiteRevokedTokensRepository(db)
+		app.EventRepository = NewSQLiteEventRepository(db)
+		app.FollowRepository = NewSQLiteFollowRepository(db)
+	case database.DriverMemory:
+		app.useDB(database.NewMemory())
+	default:
+		keys, err := database.NewKeyring(env.EncryptionKeys.Key, env.EncryptionKeys.PreviousKeys...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid database encryption key : %s", err)
+		}
+
+		db, err := database.New(path, database.Options{
+			Reset:         env.ResetDB,
+			Recover:       env.RecoverDB,
+			WAL:           env.DBMode == "wal",
+			FlushInterval: env.FlushInterval,
+			Keys:          keys,
+		})
+		if err != nil {
+			return nil, err
+		}
+		app.useDB(db)
 	}
+
+	app.withTimeouts(Timeouts{Read: env.DBReadTimeout, Write: env.DBWriteTimeout})
+
+	err = app.normalizeStoredEmails(context.Background())
+	if err != nil {
+		app.Close()
+		return nil, err
+	}
+
+	err = app.buildSearchIndex(context.Background())
+	if err != nil {
+		app.Close()
+		return nil, fmt.Errorf("failed to build the search index : %s", err)
+	}
+	return app, nil
+}
+
+// useDB wires the repositories of the JSON database, which serve the in-memory database as well.
+func (app *App) useDB(db *database.DB) {
+	app.DB = db
+	app.ChirpRepository = NewJSONChirpResository(db)
+	app.UserRepository = NewJSONUserRepository(db)
+	app.RevokedTokensRepository = NewJSONRevokedTokensRepository(db)
+	app.EventRepository = NewJSONEventRepository(db)
+	app.FollowRepository = NewJSONFollowRepository(db)
 }
 
+// Run serves, delivers events to the subscribers, purges expired data and computes the trending hashtags until the process receives
+// an interrupt or termination signal, then stops accepting requests, waits for in-flight ones and closes the database.
 func (app *App) Run(server *http.Server) {
-	// TODO: implement graceful shutdown here
-	log.Printf("serving from %s on port:%s", app.Env.FileserverPath, app.Env.Port)
-	log.Fatal(server.ListenAndServe())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	purged := make(chan struct{})
+	go func() {
+		defer close(purged)
+		app.PurgeExpired(ctx)
+	}()
+
+	delivered := make(chan struct{})
+	go func() {
+		defer close(delivered)
+		app.DeliverEvents(ctx)
+	}()
+
+	trended := make(chan struct{})
+	go func() {
+		defer close(trended)
+		app.ComputeTrendingHashtags(ctx)
+	}()
+
+	go func() {
+		log.Printf("serving from %s on port:%s", app.Env.FileserverPath, app.Env.Port)
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Print("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("failed to shut down gracefully : %s", err)
+	}
+
+	<-purged
+	<-delivered
+	<-trended
+	err = app.Close()
+	if err != nil {
+		log.Fatalf("failed to close database : %s", err)
+	}
+}
+
+// Close releases the storage backend, flushing any change that has not reached the disk yet.
+func (app *App) Close() error {
+	if app.DB != nil {
+		return app.DB.Close()
+	}
+	if app.SQLite != nil {
+		return app.SQLite.Close()
+	}
+	return nil
 }
@@ -0,0 +1,20 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/zoumas/chirpy/json/internal/env"
+)
+
+// newTestApp returns an App backed by a fresh in-memory database.
+func newTestApp(t testing.TB) *App {
+	t.Helper()
+
+	app, err := New(&env.Env{
+		DSN:       "memory://",
+		JwtSecret: "test-secret",
+	})
+	assertNoError(t, err)
+	t.Cleanup(func() { app.Close() })
+	return app
+}
@@ -1,13 +1,14 @@
 package app
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/id"
 )
 
 type AuthedHandler func(w http.ResponseWriter, r *http.Request, user database.User)
@@ -60,7 +61,7 @@ func (app *App) WithAccessToken(handler AuthedHandler) http.HandlerFunc {
 			return
 		}
 
-		userIDString, err := token.Claims.GetSubject()
+		subject, err := token.Claims.GetSubject()
 		if err != nil {
 			respondWithError(
 				w,
@@ -69,24 +70,17 @@ func (app *App) WithAccessToken(handler AuthedHandler) http.HandlerFunc {
 			)
 			return
 		}
+		// Tokens issued before IDs were ULIDs carry integer IDs.
+		userID := id.Normalize(subject)
 
-		userID, err := strconv.Atoi(userIDString)
-		if err != nil {
-			respondWithError(
-				w,
-				http.StatusInternalServerError,
-				fmt.Sprintf("failed to parse user ID: %s", err.Error()),
-			)
-			return
-		}
-
-		user, err := app.UserRepository.GetByID(userID)
+		user, err := app.UserRepository.GetByID(r.Context(), userID)
 		if err != nil {
 			respondWithError(
 				w,
 				http.StatusUnauthorized,
 				fmt.Sprintf("failed to retrieve user : %s", err.Error()),
 			)
+			return
 		}
 
 		handler(w, r, user)
@@ -95,7 +89,7 @@ func (app *App) WithAccessToken(handler AuthedHandler) http.HandlerFunc {
 
 type WithRefreshTokenParams struct {
 	token  string
-	userID int
+	userID string
 }
 
 func (app *App) WithRefreshToken(
@@ -148,7 +142,7 @@ func (app *App) WithRefreshToken(
 			return
 		}
 
-		userIDString, err := token.Claims.GetSubject()
+		subject, err := token.Claims.GetSubject()
 		if err != nil {
 			respondWithError(
 				w,
@@ -157,16 +151,8 @@ func (app *App) WithRefreshToken(
 			)
 			return
 		}
-
-		userID, err := strconv.Atoi(userIDString)
-		if err != nil {
-			respondWithError(
-				w,
-				http.StatusInternalServerError,
-				fmt.Sprintf("failed to parse user ID: %s", err.Error()),
-			)
-			return
-		}
+		// Tokens issued before IDs were ULIDs carry integer IDs.
+		userID := id.Normalize(subject)
 
 		signedToken, err := token.SignedString([]byte(app.Env.JwtSecret))
 		if err != nil {
@@ -178,6 +164,29 @@ func (app *App) WithRefreshToken(
 	}
 }
 
+// WithAdminApiKey only lets through requests authorized with ADMIN_API_KEY.
+func (app *App) WithAdminApiKey(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.Env.AdminApiKey == "" {
+			respondWithError(w, http.StatusForbidden, "admin API is disabled")
+			return
+		}
+
+		authFields := strings.Fields(r.Header.Get("Authorization"))
+		if len(authFields) != 2 || authFields[0] != "ApiKey" {
+			respondWithError(w, http.StatusUnauthorized, "missing or malformed Authorization header")
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(authFields[1]), []byte(app.Env.AdminApiKey)) != 1 {
+			respondWithError(w, http.StatusUnauthorized, "invalid API key")
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}
+}
+
 func (app *App) WithPolkaApiKey(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
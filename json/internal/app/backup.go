@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+// maxRestoreSize bounds the size of the compressed snapshot of a restore request.
+const maxRestoreSize = 512 << 20
+
+// Backup streams a gzip-compressed snapshot of the database.
+func (app *App) Backup(w http.ResponseWriter, r *http.Request) {
+	if app.DB == nil {
+		respondWithError(w, http.StatusNotImplemented, "backups are only supported by the JSON database")
+		return
+	}
+
+	filename := fmt.Sprintf("chirpy-%s.json.gz", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	err := app.DB.Backup(w)
+	if err != nil {
+		// Part of the body may already be sent; a truncated gzip stream tells the client the backup failed.
+		log.Printf("failed to stream backup : %s", err)
+	}
+}
+
+// A RestoreHook rebuilds state derived from the database after it is restored.
+type RestoreHook func(ctx context.Context) error
+
+// OnRestore registers hook to run every time the database is restored, before events are delivered again.
+// OnRestore must be called before Run.
+func (app *App) OnRestore(hook RestoreHook) {
+	app.restoreHooks = append(app.restoreHooks, hook)
+}
+
+// Restore replaces the content of the database with the snapshot in the request body, as streamed by Backup,
+// then runs the restore hooks.
+func (app *App) Restore(w http.ResponseWriter, r *http.Request) {
+	if app.DB == nil {
+		respondWithError(w, http.StatusNotImplemented, "backups are only supported by the JSON database")
+		return
+	}
+
+	// No event is delivered while the database is restored, or a subscriber could move its cursor
+	// in the restored database to an event of the old one.
+	app.restoreMu.Lock()
+	defer app.restoreMu.Unlock()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRestoreSize)
+	defer r.Body.Close()
+	err := app.DB.Restore(r.Body)
+	maxBytesErr := &http.MaxBytesError{}
+	if errors.Is(err, database.ErrSnapshotTooLarge) || errors.As(err, &maxBytesErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrInvalidSnapshot) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, hook := range app.restoreHooks {
+		err := hook(r.Context())
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("restored, but failed to rebuild derived state : %s", err))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
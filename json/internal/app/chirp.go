@@ -2,27 +2,28 @@ package app
 
 import (
 	"cmp"
+	"context"
 	"encoding/json"
 	"net/http"
 	"slices"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/hashtag"
+	"github.com/zoumas/chirpy/json/internal/id"
 )
 
-type ChirpErr string
-
-func (e ChirpErr) Error() string {
-	return string(e)
-}
+type ChirpErr = database.ChirpErr
 
 const (
-	ErrChirpTooLong   = ChirpErr("Chirp is too long")
-	ErrChirpEmpty     = ChirpErr("Chirp is empty")
-	ErrChirpNotFound  = ChirpErr("Chirp not found")
-	ErrChirpNotAuthor = ChirpErr("Chirp is not owned by this user")
+	ErrChirpTooLong         = ChirpErr("Chirp is too long")
+	ErrChirpEmpty           = ChirpErr("Chirp is empty")
+	ErrChirpNotFound        = database.ErrChirpNotFound
+	ErrChirpNotAuthor       = database.ErrChirpNotAuthor
+	ErrChirpNotDeleted      = database.ErrChirpNotDeleted
+	ErrChirpVersionMismatch = database.ErrChirpVersionMismatch
 )
 
 type JSONChirpRepository struct {
@@ -33,18 +34,22 @@ func NewJSONChirpResository(db *database.DB) *JSONChirpRepository {
 	return &JSONChirpRepository{db: db}
 }
 
-// Create creates a new Chirp from a given body and stores it in the database; auto-incrementing the ID.
-func (r *JSONChirpRepository) Create(params database.CreateChirpParams) (database.Chirp, error) {
-	dbs, err := r.db.Load()
-	if err != nil {
-		return database.Chirp{}, err
-	}
-
-	id := len(dbs.Chirps) + 1
-	chirp := database.Chirp{ID: id, Body: params.Body, UserID: params.UserID}
-	dbs.Chirps[id] = chirp
-
-	err = r.db.Persist(dbs)
+// Create creates a new Chirp from a given body and stores it in the database under a new ID.
+func (r *JSONChirpRepository) Create(ctx context.Context, params database.CreateChirpParams) (database.Chirp, error) {
+	chirp := database.Chirp{}
+	err := r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		chirp = database.Chirp{
+			ID:       id.New(),
+			Body:     params.Body,
+			UserID:   params.UserID,
+			Hashtags: params.Hashtags,
+			Mentions: params.Mentions,
+			Version:  1,
+		}
+		dbs.PutChirp(chirp)
+		dbs.AppendEvent(database.NewChirpEvent(database.EventChirpCreated, chirp))
+		return nil
+	})
 	if err != nil {
 		return database.Chirp{}, err
 	}
@@ -53,64 +58,140 @@ func (r *JSONChirpRepository) Create(params database.CreateChirpParams) (databas
 }
 
 // GetAll retrieves all the chirps from the database
-func (r *JSONChirpRepository) GetAll() ([]database.Chirp, error) {
-	dbs, err := r.db.Load()
+func (r *JSONChirpRepository) GetAll(ctx context.Context) ([]database.Chirp, error) {
+	var chirps []database.Chirp
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		chirps = make([]database.Chirp, 0, len(dbs.Chirps))
+		for _, chirp := range dbs.Chirps {
+			if chirp.DeletedAt == nil {
+				chirps = append(chirps, chirp)
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	chirps := make([]database.Chirp, 0, len(dbs.Chirps))
-	for _, chirp := range dbs.Chirps {
-		chirps = append(chirps, chirp)
-	}
 	return chirps, nil
 }
 
-func (r *JSONChirpRepository) GetByUserID(userID int) ([]database.Chirp, error) {
-	dbs, err := r.db.Load()
+func (r *JSONChirpRepository) GetByUserID(ctx context.Context, userID string) ([]database.Chirp, error) {
+	var chirps []database.Chirp
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		chirps = slices.DeleteFunc(dbs.ChirpsByAuthor(userID), func(chirp database.Chirp) bool {
+			return chirp.DeletedAt != nil
+		})
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return chirps, nil
+}
 
-	chirps := make([]database.Chirp, 0, len(dbs.Chirps))
-	for _, chirp := range dbs.Chirps {
-		if chirp.UserID == userID {
-			chirps = append(chirps, chirp)
-		}
+func (r *JSONChirpRepository) List(ctx context.Context, params database.ListChirpsParams) ([]database.Chirp, error) {
+	var chirps []database.Chirp
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		chirps = dbs.ListChirps(params)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return chirps, nil
 }
 
-func (r *JSONChirpRepository) GetByID(id int) (database.Chirp, error) {
-	dbs, err := r.db.Load()
+func (r *JSONChirpRepository) GetByID(ctx context.Context, id string) (database.Chirp, error) {
+	chirp := database.Chirp{}
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		var ok bool
+		chirp, ok = dbs.Chirps[id]
+		if !ok || chirp.DeletedAt != nil {
+			return ErrChirpNotFound
+		}
+		return nil
+	})
 	if err != nil {
 		return database.Chirp{}, err
 	}
-
-	chirp, ok := dbs.Chirps[id]
-	if !ok {
-		return database.Chirp{}, ErrChirpNotFound
-	}
 	return chirp, nil
 }
 
-func (r *JSONChirpRepository) Delete(params database.DeleteChirpParams) error {
-	dbs, err := r.db.Load()
-	if err != nil {
-		return err
-	}
+func (r *JSONChirpRepository) Delete(ctx context.Context, params database.DeleteChirpParams) error {
+	return r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		chirp, ok := dbs.Chirps[params.ID]
+		if !ok || chirp.DeletedAt != nil {
+			return ErrChirpNotFound
+		}
 
-	chirp, ok := dbs.Chirps[params.ID]
-	if !ok {
-		return ErrChirpNotFound
-	}
+		if chirp.UserID != params.UserID {
+			return ErrChirpNotAuthor
+		}
+
+		if !params.IfVersions.Match(chirp.Version) {
+			return ErrChirpVersionMismatch
+		}
+
+		deletedAt := time.Now().UTC()
+		chirp.DeletedAt = &deletedAt
+		chirp.Version++
+		dbs.PutChirp(chirp)
+		dbs.AppendEvent(database.NewChirpEvent(database.EventChirpDeleted, chirp))
+		return nil
+	})
+}
+
+func (r *JSONChirpRepository) Restore(
+	ctx context.Context,
+	params database.RestoreChirpParams,
+) (database.Chirp, error) {
+	chirp := database.Chirp{}
+	err := r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		var ok bool
+		chirp, ok = dbs.Chirps[params.ID]
+		if !ok || (chirp.DeletedAt != nil && chirp.DeletedAt.Before(params.DeletedSince)) {
+			return ErrChirpNotFound
+		}
 
-	if chirp.UserID != params.UserID {
-		return ErrChirpNotAuthor
+		if chirp.UserID != params.UserID {
+			return ErrChirpNotAuthor
+		}
+
+		if !params.IfVersions.Match(chirp.Version) {
+			return ErrChirpVersionMismatch
+		}
+
+		if chirp.DeletedAt == nil {
+			return ErrChirpNotDeleted
+		}
+
+		chirp.DeletedAt = nil
+		chirp.Version++
+		dbs.PutChirp(chirp)
+		dbs.AppendEvent(database.NewChirpEvent(database.EventChirpRestored, chirp))
+		return nil
+	})
+	if err != nil {
+		return database.Chirp{}, err
 	}
+	return chirp, nil
+}
 
-	delete(dbs.Chirps, params.ID)
-	return r.db.Persist(dbs)
+func (r *JSONChirpRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	purged := 0
+	err := r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		for id, chirp := range dbs.Chirps {
+			if chirp.DeletedAt != nil && chirp.DeletedAt.Before(deletedBefore) {
+				dbs.DeleteChirp(id)
+				purged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
 }
 
 func ValidateChirpLength(body string) error {
@@ -126,6 +207,23 @@ func ValidateChirpLength(body string) error {
 	return nil
 }
 
+// profaneWords are replaced in chirp bodies by CleanChirpBody.
+var profaneWords = map[string]struct{}{
+	"kerfuffle": {},
+	"sharbert":  {},
+	"fornax":    {},
+}
+
+// PrepareChirpBody validates a chirp body and returns it cleaned of profanity, ready to be stored.
+func PrepareChirpBody(body string) (string, error) {
+	err := ValidateChirpLength(body)
+	if err != nil {
+		return "", err
+	}
+
+	return CleanChirpBody(body, profaneWords, "****"), nil
+}
+
 func CleanChirpBody(
 	body string,
 	profane map[string]struct{},
@@ -156,61 +254,115 @@ func (app *App) CreateChirp(w http.ResponseWriter, r *http.Request, user databas
 		return
 	}
 
-	err = ValidateChirpLength(body.Body)
+	cleanedBody, err := PrepareChirpBody(body.Body)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	token := struct{}{}
-	profane := map[string]struct{}{
-		"kerfuffle": token,
-		"sharbert":  token,
-		"fornax":    token,
+	mentions, err := app.resolveMentions(r.Context(), cleanedBody)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to resolve mentions")
+		return
 	}
-	replaceWith := "****"
-	cleanedBody := CleanChirpBody(body.Body, profane, replaceWith)
 
-	chirp, err := app.ChirpRepository.Create(database.CreateChirpParams{
-		Body:   cleanedBody,
-		UserID: user.ID,
+	chirp, err := app.ChirpRepository.Create(r.Context(), database.CreateChirpParams{
+		Body:     cleanedBody,
+		UserID:   user.ID,
+		Hashtags: hashtag.Parse(cleanedBody),
+		Mentions: mentions,
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "failed to create chirp")
 		return
 	}
 
+	w.Header().Set("ETag", etag(chirp.Version))
 	respondWithJSON(w, http.StatusCreated, chirp)
 }
 
+// GetAllChirps responds with the chirps, optionally of a single author, sorted by creation time.
+// When the limit or cursor query parameter is set, it responds with a single page instead.
 func (app *App) GetAllChirps(w http.ResponseWriter, r *http.Request) {
-	authorIDString := r.URL.Query().Get("author_id")
+	query := r.URL.Query()
+	if query.Has("limit") || query.Has("cursor") {
+		app.getChirpsPage(w, r, database.ListChirpsParams{AuthorID: id.Normalize(query.Get("author_id"))})
+		return
+	}
+
+	authorID := query.Get("author_id")
 
 	var chirps []database.Chirp
 	var err error
 
-	if authorIDString == "" {
-		chirps, err = app.ChirpRepository.GetAll()
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "failed to retrieve chirps")
-			return
-		}
+	if authorID == "" {
+		chirps, err = app.ChirpRepository.GetAll(r.Context())
 	} else {
-		authorID, err := strconv.Atoi(authorIDString)
-		if err != nil {
-			respondWithError(w, http.StatusBadRequest, "failed to parse user id")
-			return
-		}
+		chirps, err = app.ChirpRepository.GetByUserID(r.Context(), id.Normalize(authorID))
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to retrieve chirps")
+		return
+	}
 
-		chirps, err = app.ChirpRepository.GetByUserID(authorID)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "failed to retrieve chirps")
-			return
-		}
+	sortChirps(chirps, query.Get("sort") == "desc")
+	respondWithJSON(w, http.StatusOK, chirps)
+}
+
+// GetChirpsByHashtag responds with a page of the chirps tagged with the tag URL parameter, sorted by creation time.
+func (app *App) GetChirpsByHashtag(w http.ResponseWriter, r *http.Request) {
+	tag := hashtag.Normalize(chi.URLParam(r, "tag"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "missing url parameter")
+		return
+	}
+
+	app.getChirpsPage(w, r, database.ListChirpsParams{Hashtag: tag})
+}
+
+// getChirpsPage responds with the page of the chirps that match filter selected by the cursor, limit
+// and sort query parameters. The page after it, if any, is linked by next_cursor and the Link header.
+func (app *App) getChirpsPage(w http.ResponseWriter, r *http.Request, filter database.ListChirpsParams) {
+	query := r.URL.Query()
+
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	after, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// One more chirp than the limit tells whether there is a next page.
+	filter.After = after
+	filter.Desc = query.Get("sort") == "desc"
+	filter.Limit = limit + 1
+	chirps, err := app.ChirpRepository.List(r.Context(), filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to retrieve chirps")
+		return
 	}
 
-	sortParam := r.URL.Query().Get("sort")
+	type ResponseBody struct {
+		Chirps     []database.Chirp `json:"chirps"`
+		NextCursor string           `json:"next_cursor,omitempty"`
+	}
+	body := ResponseBody{Chirps: chirps}
+	if len(chirps) > limit {
+		body.Chirps = chirps[:limit]
+		body.NextCursor = encodeCursor(chirps[limit-1].ID)
+		w.Header().Set("Link", nextLink(r.URL, body.NextCursor))
+	}
+	respondWithJSON(w, http.StatusOK, body)
+}
 
-	if sortParam == "desc" {
+// sortChirps sorts chirps by ID, which sorts them by creation time.
+func sortChirps(chirps []database.Chirp, desc bool) {
+	if desc {
 		slices.SortStableFunc(chirps, func(a, b database.Chirp) int {
 			return cmp.Compare(b.ID, a.ID)
 		})
@@ -219,24 +371,16 @@ func (app *App) GetAllChirps(w http.ResponseWriter, r *http.Request) {
 			return cmp.Compare(a.ID, b.ID)
 		})
 	}
-
-	respondWithJSON(w, http.StatusOK, chirps)
 }
 
 func (app *App) GetChirpByID(w http.ResponseWriter, r *http.Request) {
-	idString := chi.URLParam(r, "id")
-	if idString == "" {
+	chirpID := chi.URLParam(r, "id")
+	if chirpID == "" {
 		respondWithError(w, http.StatusBadRequest, "missing url parameter")
 		return
 	}
 
-	id, err := strconv.Atoi(idString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "failed to parse url parameter")
-		return
-	}
-
-	chirp, err := app.ChirpRepository.GetByID(id)
+	chirp, err := app.ChirpRepository.GetByID(r.Context(), id.Normalize(chirpID))
 	if err != nil {
 		if err == ErrChirpNotFound {
 			respondWithError(w, http.StatusNotFound, ErrChirpEmpty.Error())
@@ -246,26 +390,71 @@ func (app *App) GetChirpByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tag := etag(chirp.Version)
+	w.Header().Set("ETag", tag)
+	if ifNoneMatch(r, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, chirp)
 }
 
 func (app *App) DeleteChirp(w http.ResponseWriter, r *http.Request, user database.User) {
-	idString := chi.URLParam(r, "id")
-	if idString == "" {
+	chirpID := chi.URLParam(r, "id")
+	if chirpID == "" {
 		respondWithError(w, http.StatusBadRequest, "missing url parameter")
 		return
 	}
 
-	id, err := strconv.Atoi(idString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "failed to parse url parameter")
+	err := app.ChirpRepository.Delete(r.Context(), database.DeleteChirpParams{
+		ID:         id.Normalize(chirpID),
+		UserID:     user.ID,
+		IfVersions: ifMatchVersions(r),
+	})
+	if err == ErrChirpVersionMismatch {
+		respondWithError(w, http.StatusPreconditionFailed, err.Error())
 		return
 	}
-
-	err = app.ChirpRepository.Delete(database.DeleteChirpParams{ID: id, UserID: user.ID})
 	if err != nil {
 		respondWithError(w, http.StatusForbidden, err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
+
+func (app *App) RestoreChirp(w http.ResponseWriter, r *http.Request, user database.User) {
+	chirpID := chi.URLParam(r, "id")
+	if chirpID == "" {
+		respondWithError(w, http.StatusBadRequest, "missing url parameter")
+		return
+	}
+
+	chirp, err := app.ChirpRepository.Restore(r.Context(), database.RestoreChirpParams{
+		ID:           id.Normalize(chirpID),
+		UserID:       user.ID,
+		DeletedSince: time.Now().Add(-app.Env.ChirpRetention),
+		IfVersions:   ifMatchVersions(r),
+	})
+	switch err {
+	case nil:
+	case ErrChirpNotFound:
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	case ErrChirpNotAuthor:
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	case ErrChirpNotDeleted:
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	case ErrChirpVersionMismatch:
+		respondWithError(w, http.StatusPreconditionFailed, err.Error())
+		return
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("ETag", etag(chirp.Version))
+	respondWithJSON(w, http.StatusOK, chirp)
+}
@@ -1,6 +1,19 @@
 package app
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zoumas/chirpy/json/internal/database"
+)
 
 func TestValidateChirpLength(t *testing.T) {
 	t.Run("small chirp", func(t *testing.T) {
@@ -71,6 +84,74 @@ func TestCleanChirpBody(t *testing.T) {
 	}
 }
 
+func TestCreateChirpConcurrently(t *testing.T) {
+	app := newTestApp(t)
+
+	user, err := app.UserRepository.Create(context.Background(), database.CreateUserParams{Email: "a@example.com"})
+	assertNoError(t, err)
+	token, err := NewAccessToken(user.ID).SignedString([]byte(app.Env.JwtSecret))
+	assertNoError(t, err)
+
+	handler := app.WithAccessToken(app.CreateChirp)
+
+	const n = 50
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			r := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"hello"}`))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != http.StatusCreated {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusCreated)
+			}
+		}()
+	}
+	wg.Wait()
+
+	chirps, err := app.ChirpRepository.GetAll(context.Background())
+	assertNoError(t, err)
+	if len(chirps) != n {
+		t.Fatalf("got %d chirps, want %d", len(chirps), n)
+	}
+
+	ids := make(map[string]struct{}, n)
+	for _, chirp := range chirps {
+		ids[chirp.ID] = struct{}{}
+	}
+	if len(ids) != n {
+		t.Errorf("got %d distinct chirp ids, want %d", len(ids), n)
+	}
+}
+
+func TestCreateChirpNeverReusesIDs(t *testing.T) {
+	app := newTestApp(t)
+
+	first, err := app.ChirpRepository.Create(context.Background(), database.CreateChirpParams{Body: "first", UserID: "1"})
+	assertNoError(t, err)
+	second, err := app.ChirpRepository.Create(context.Background(), database.CreateChirpParams{Body: "second", UserID: "1"})
+	assertNoError(t, err)
+
+	err = app.ChirpRepository.Delete(context.Background(), database.DeleteChirpParams{ID: first.ID, UserID: "1"})
+	assertNoError(t, err)
+
+	third, err := app.ChirpRepository.Create(context.Background(), database.CreateChirpParams{Body: "third", UserID: "1"})
+	assertNoError(t, err)
+	if third.ID == first.ID || third.ID == second.ID {
+		t.Fatalf("got reused id %q", third.ID)
+	}
+
+	chirp, err := app.ChirpRepository.GetByID(context.Background(), second.ID)
+	assertNoError(t, err)
+	if chirp.Body != "second" {
+		t.Errorf("chirp %q was overwritten: %q", second.ID, chirp.Body)
+	}
+}
+
 func assertNoError(t testing.TB, err error) {
 	t.Helper()
 
@@ -86,3 +167,95 @@ func assertError(t testing.TB, got, want error) {
 		t.Fatalf("got: %s\nwant: %s", got, want)
 	}
 }
+
+func TestRestoreChirp(t *testing.T) {
+	cases := []struct {
+		Desc      string
+		Retention time.Duration
+		Status    int
+	}{
+		{Desc: "within the retention window", Retention: time.Hour, Status: http.StatusOK},
+		{Desc: "past the retention window", Retention: 0, Status: http.StatusNotFound},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.Desc, func(t *testing.T) {
+			app := newTestApp(t)
+			app.Env.ChirpRetention = cs.Retention
+
+			user, err := app.UserRepository.Create(context.Background(), database.CreateUserParams{Email: "a@example.com"})
+			assertNoError(t, err)
+			chirp, err := app.ChirpRepository.Create(context.Background(), database.CreateChirpParams{Body: "oops", UserID: user.ID})
+			assertNoError(t, err)
+			err = app.ChirpRepository.Delete(context.Background(), database.DeleteChirpParams{ID: chirp.ID, UserID: user.ID})
+			assertNoError(t, err)
+
+			router := chi.NewRouter()
+			router.Post("/api/chirps/{id}/restore", app.WithAccessToken(app.RestoreChirp))
+			token, err := NewAccessToken(user.ID).SignedString([]byte(app.Env.JwtSecret))
+			assertNoError(t, err)
+
+			r := httptest.NewRequest(http.MethodPost, "/api/chirps/"+chirp.ID+"/restore", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != cs.Status {
+				t.Fatalf("got status %d, want %d : %s", w.Code, cs.Status, w.Body)
+			}
+		})
+	}
+}
+
+func TestGetAllChirpsPages(t *testing.T) {
+	app := newTestApp(t)
+	var want []string
+	for i := 0; i < 5; i++ {
+		chirp, err := app.ChirpRepository.Create(context.Background(), database.CreateChirpParams{Body: "hello", UserID: "1"})
+		assertNoError(t, err)
+		want = append([]string{chirp.ID}, want...)
+	}
+
+	type Page struct {
+		Chirps     []database.Chirp `json:"chirps"`
+		NextCursor string           `json:"next_cursor"`
+	}
+	var got []string
+	target := "/api/chirps?sort=desc&limit=2"
+	for pages := 1; ; pages++ {
+		w := httptest.NewRecorder()
+		app.GetAllChirps(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		page := Page{}
+		assertNoError(t, json.NewDecoder(w.Body).Decode(&page))
+		for _, chirp := range page.Chirps {
+			got = append(got, chirp.ID)
+		}
+
+		link := w.Header().Get("Link")
+		if page.NextCursor == "" {
+			if link != "" || pages != 3 {
+				t.Fatalf("got last page %d with Link %q, want page 3 without Link", pages, link)
+			}
+			break
+		}
+		target = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		if !strings.Contains(target, "cursor="+page.NextCursor) || !strings.Contains(target, "sort=desc") {
+			t.Fatalf("got Link %q for next_cursor %q", link, page.NextCursor)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got: %v\nwant: %v", got, want)
+	}
+
+	for _, target := range []string{"/api/chirps?limit=0", "/api/chirps?limit=101", "/api/chirps?cursor=nope"} {
+		w := httptest.NewRecorder()
+		app.GetAllChirps(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s : got status %d, want %d", target, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -2,19 +2,25 @@ package app
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+
+	"github.com/zoumas/chirpy/json/internal/id"
 )
 
 func (app *App) SubscribeToChirpyRed(w http.ResponseWriter, r *http.Request) {
 	type RequestBody struct {
 		Event string `json:"event"`
 		Data  struct {
-			UserID int `json:"user_id"`
+			// UserID is a string, or a number for users created before IDs were ULIDs.
+			UserID any `json:"user_id"`
 		} `json:"data"`
 	}
 	body := RequestBody{}
 
-	err := json.NewDecoder(r.Body).Decode(&body)
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	err := decoder.Decode(&body)
 	if err != nil {
 		// This is really bad btw. If you can't decode a webhook's request body then
 		// the webhook will be trying the same request you can't decode over and over again.
@@ -27,7 +33,7 @@ func (app *App) SubscribeToChirpyRed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = app.UserRepository.UpgradeToRed(body.Data.UserID)
+	_, err = app.UserRepository.UpgradeToRed(r.Context(), id.Normalize(fmt.Sprint(body.Data.UserID)))
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		return
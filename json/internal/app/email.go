@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+// NormalizeEmail returns the form of an email address that identifies a user.
+// Surrounding whitespace is trimmed and the whole address is lowercased: the local part is case-sensitive
+// in theory, but no provider treats it that way and users expect Foo@Example.com to be foo@example.com.
+// For the domains in plusFoldingDomains the +tag of the local part is dropped,
+// so that me+chirpy@gmail.com and me@gmail.com are the same user.
+func NormalizeEmail(email string, plusFoldingDomains []string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+
+	for _, foldingDomain := range plusFoldingDomains {
+		if domain == strings.ToLower(foldingDomain) {
+			local, _, _ = strings.Cut(local, "+")
+			break
+		}
+	}
+
+	return local + "@" + domain
+}
+
+func (app *App) normalizeEmail(email string) string {
+	return NormalizeEmail(email, app.Env.PlusFoldingDomains)
+}
+
+// ErrEmailCollision is returned on startup when the stored emails of several users are the same once normalized.
+var ErrEmailCollision = database.ErrEmailCollision
+
+// normalizeStoredEmails brings the stored emails in line with the normalization in effect, which can change with
+// EMAIL_PLUS_FOLDING_DOMAINS: a user stored as me+tag@gmail.com can only log in once the email is stored as me@gmail.com.
+// Users whose distinct emails become the same fail with ErrEmailCollision rather than locking all but one of them out.
+func (app *App) normalizeStoredEmails(ctx context.Context) error {
+	users, err := app.UserRepository.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[string][]database.User, len(users))
+	for _, user := range users {
+		normalized := app.normalizeEmail(user.Email)
+		owners[normalized] = append(owners[normalized], user)
+	}
+
+	var collisions []string
+	for normalized, owners := range owners {
+		if len(owners) == 1 {
+			user := owners[0]
+			if user.Email == normalized {
+				continue
+			}
+			_, err := app.UserRepository.Update(ctx, user.ID, database.UpdateUserParams{Email: &normalized})
+			if err != nil {
+				return fmt.Errorf("failed to normalize the email of user %s : %w", user.ID, err)
+			}
+			log.Printf("normalized the email of user %s to %q", user.ID, normalized)
+			continue
+		}
+
+		userIDs := make([]string, 0, len(owners))
+		for _, user := range owners {
+			userIDs = append(userIDs, user.ID)
+		}
+		slices.Sort(userIDs)
+		collisions = append(collisions, fmt.Sprintf("users %s all normalize to %q", strings.Join(userIDs, ", "), normalized))
+	}
+
+	if len(collisions) > 0 {
+		slices.Sort(collisions)
+		return fmt.Errorf(
+			"%w : %s (change their emails, or remove their domain from EMAIL_PLUS_FOLDING_DOMAINS if it folds them together)",
+			ErrEmailCollision,
+			strings.Join(collisions, "; "),
+		)
+	}
+	return nil
+}
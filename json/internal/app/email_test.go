@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/env"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	plusFoldingDomains := []string{"gmail.com"}
+
+	cases := []struct {
+		Desc       string
+		Email      string
+		Normalized string
+	}{
+		{Desc: "already normalized", Email: "foo@example.com", Normalized: "foo@example.com"},
+		{Desc: "mixed case", Email: "Foo@Example.COM", Normalized: "foo@example.com"},
+		{Desc: "surrounding whitespace", Email: "  foo@example.com\n", Normalized: "foo@example.com"},
+		{Desc: "plus alias on a folding domain", Email: "Foo+Chirpy@Gmail.com", Normalized: "foo@gmail.com"},
+		{Desc: "plus alias on another domain", Email: "foo+chirpy@example.com", Normalized: "foo+chirpy@example.com"},
+		{Desc: "not an email", Email: " Foo ", Normalized: "foo"},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.Desc, func(t *testing.T) {
+			if got := NormalizeEmail(cs.Email, plusFoldingDomains); got != cs.Normalized {
+				t.Errorf("\ngot: %q\nwant: %q", got, cs.Normalized)
+			}
+		})
+	}
+}
+
+func TestNormalizeStoredEmailsOnStartup(t *testing.T) {
+	ctx := context.Background()
+
+	create := func(t *testing.T, emails ...string) string {
+		path := filepath.Join(t.TempDir(), "database.json")
+		app, err := New(&env.Env{DSN: path})
+		assertNoError(t, err)
+		for _, email := range emails {
+			_, err := app.UserRepository.Create(ctx, database.CreateUserParams{Email: email})
+			assertNoError(t, err)
+		}
+		assertNoError(t, app.Close())
+		return path
+	}
+
+	t.Run("plus aliases are folded", func(t *testing.T) {
+		path := create(t, "me+chirpy@gmail.com", "other+chirpy@example.com")
+
+		app, err := New(&env.Env{DSN: path, PlusFoldingDomains: []string{"gmail.com"}})
+		assertNoError(t, err)
+		defer app.Close()
+
+		for _, email := range []string{"me@gmail.com", "other+chirpy@example.com"} {
+			_, err := app.UserRepository.GetByEmail(ctx, email)
+			if err != nil {
+				t.Errorf("user %q cannot be found : %s", email, err)
+			}
+		}
+	})
+
+	t.Run("collisions refuse to start", func(t *testing.T) {
+		path := create(t, "me+chirpy@gmail.com", "me@gmail.com")
+
+		_, err := New(&env.Env{DSN: path, PlusFoldingDomains: []string{"gmail.com"}})
+		if !errors.Is(err, ErrEmailCollision) {
+			t.Fatalf("got: %v\nwant: %v", err, ErrEmailCollision)
+		}
+
+		app, err := New(&env.Env{DSN: path})
+		assertNoError(t, err)
+		app.Close()
+	})
+
+	t.Run("case variants refuse to start", func(t *testing.T) {
+		path := create(t, "Me@example.com", "me@example.com")
+
+		_, err := New(&env.Env{DSN: path})
+		if !errors.Is(err, ErrEmailCollision) {
+			t.Fatalf("got: %v\nwant: %v", err, ErrEmailCollision)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+// etag returns the entity tag of a version of a user or chirp.
+func etag(version int) string {
+	return fmt.Sprintf("%q", strconv.Itoa(version))
+}
+
+// ifMatchVersions returns the versions the If-Match header of r allows, or nil if it allows any.
+// The header is a comma separated list of entity tags, or "*" for any version of an existing entity.
+// Weak tags and anything that is not the tag of a version never match.
+func ifMatchVersions(r *http.Request) database.Versions {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil
+	}
+
+	// -1 is not a version: a header without any valid tag matches none.
+	versions := database.Versions{-1}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		unquoted, err := strconv.Unquote(candidate)
+		if err != nil || !strings.HasPrefix(candidate, `"`) {
+			continue
+		}
+		version, err := strconv.Atoi(unquoted)
+		if err != nil || version <= 0 {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// ifNoneMatch reports whether the If-None-Match header of r matches tag, using the weak comparison.
+func ifNoneMatch(r *http.Request, tag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+func TestUpdateUserIfMatch(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.UserRepository.Create(context.Background(), database.CreateUserParams{Email: "a@example.com"})
+	assertNoError(t, err)
+	token, err := NewAccessToken(user.ID).SignedString([]byte(app.Env.JwtSecret))
+	assertNoError(t, err)
+	handler := app.WithAccessToken(app.UpdateUser)
+
+	update := func(ifMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(`{"email":"a@example.com","password":"x"}`))
+		r.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	// Both tabs loaded version 1: the first write wins, the second is rejected instead of overwriting it.
+	first := update(etag(1))
+	if first.Code != http.StatusOK || first.Header().Get("ETag") != etag(2) {
+		t.Fatalf("got status %d and ETag %s, want %d and %s", first.Code, first.Header().Get("ETag"), http.StatusOK, etag(2))
+	}
+	for _, ifMatch := range []string{etag(1), "W/" + etag(2), "garbage", etag(1) + ", " + etag(3)} {
+		if w := update(ifMatch); w.Code != http.StatusPreconditionFailed {
+			t.Errorf("If-Match %s : got status %d, want %d", ifMatch, w.Code, http.StatusPreconditionFailed)
+		}
+	}
+	for i, ifMatch := range []string{"", "*", etag(1) + ", " + etag(4)} {
+		if w := update(ifMatch); w.Code != http.StatusOK || w.Header().Get("ETag") != etag(3+i) {
+			t.Errorf("If-Match %q : got status %d and ETag %s, want %d and %s", ifMatch, w.Code, w.Header().Get("ETag"), http.StatusOK, etag(3+i))
+		}
+	}
+}
+
+func TestGetChirpByIDIfNoneMatch(t *testing.T) {
+	app := newTestApp(t)
+	chirp, err := app.ChirpRepository.Create(context.Background(), database.CreateChirpParams{Body: "hello", UserID: "1"})
+	assertNoError(t, err)
+	router := chi.NewRouter()
+	router.Get("/api/chirps/{id}", app.GetChirpByID)
+
+	cases := []struct {
+		Desc        string
+		IfNoneMatch string
+		Status      int
+	}{
+		{Desc: "no precondition", IfNoneMatch: "", Status: http.StatusOK},
+		{Desc: "current version", IfNoneMatch: etag(chirp.Version), Status: http.StatusNotModified},
+		{Desc: "weak current version in a list", IfNoneMatch: `"7", W/` + etag(chirp.Version), Status: http.StatusNotModified},
+		{Desc: "other version", IfNoneMatch: etag(chirp.Version + 1), Status: http.StatusOK},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.Desc, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirp.ID, nil)
+			if cs.IfNoneMatch != "" {
+				r.Header.Set("If-None-Match", cs.IfNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != cs.Status || w.Header().Get("ETag") != etag(chirp.Version) {
+				t.Errorf("got status %d and ETag %s, want %d and %s", w.Code, w.Header().Get("ETag"), cs.Status, etag(chirp.Version))
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package app
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+type JSONEventRepository struct {
+	db *database.DB
+}
+
+func NewJSONEventRepository(db *database.DB) *JSONEventRepository {
+	return &JSONEventRepository{db: db}
+}
+
+func (r *JSONEventRepository) After(ctx context.Context, seq int64, limit int) ([]database.Event, error) {
+	var events []database.Event
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		i := sort.Search(len(dbs.Events), func(i int) bool { return dbs.Events[i].Seq > seq })
+		j := min(i+limit, len(dbs.Events))
+		events = append([]database.Event{}, dbs.Events[i:j]...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *JSONEventRepository) LastSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		seq = dbs.LastEventSeq
+		return nil
+	})
+	return seq, err
+}
+
+func (r *JSONEventRepository) Cursor(ctx context.Context, consumer string) (int64, error) {
+	var seq int64
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		seq = dbs.EventCursors[consumer]
+		return nil
+	})
+	return seq, err
+}
+
+func (r *JSONEventRepository) SetCursor(ctx context.Context, consumer string, seq int64) error {
+	return r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		dbs.SetEventCursor(consumer, seq)
+		return nil
+	})
+}
+
+func (r *JSONEventRepository) Trim(ctx context.Context, before time.Time, maxSeq int64) (int, error) {
+	trimmed := 0
+	err := r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		for trimmed < len(dbs.Events) && dbs.Events[trimmed].Time.Before(before) && dbs.Events[trimmed].Seq <= maxSeq {
+			trimmed++
+		}
+		if trimmed > 0 {
+			dbs.TrimEvents(dbs.Events[trimmed-1].Seq)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return trimmed, nil
+}
+
+const (
+	// eventPollInterval is how often subscribers are checked for new events,
+	// and how long a failed delivery waits before it is retried.
+	eventPollInterval = time.Second
+	// eventBatchSize is the number of events read at once for a subscriber.
+	eventBatchSize = 100
+)
+
+// An EventHandler processes an event of the stream.
+// If it fails, the event is delivered again later, so it must be safe to process an event more than once.
+type EventHandler func(ctx context.Context, event database.Event) error
+
+type subscription struct {
+	consumer string
+	handler  EventHandler
+}
+
+// Subscribe registers handler to receive every event of the stream, in order, once Run starts.
+// consumer names the subscriber: its progress is stored under that name so that it resumes
+// where it left off after a restart. Subscribe must be called before Run.
+func (app *App) Subscribe(consumer string, handler EventHandler) {
+	app.subscriptions = append(app.subscriptions, subscription{consumer: consumer, handler: handler})
+}
+
+// DeliverEvents delivers the events to every subscriber, each at its own pace, until ctx is done.
+func (app *App) DeliverEvents(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for _, s := range app.subscriptions {
+		wg.Add(1)
+		go func(s subscription) {
+			defer wg.Done()
+			app.deliverEvents(ctx, s)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// deliverEvents delivers the pending events to s every eventPollInterval until ctx is done.
+func (app *App) deliverEvents(ctx context.Context, s subscription) {
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := app.deliverPendingEvents(ctx, s)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("failed to deliver events to %s : %s", s.consumer, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverPendingEvents hands every event after the cursor of s to its handler, in order,
+// moving the cursor past the events processed once per batch. It stops at the first failure.
+func (app *App) deliverPendingEvents(ctx context.Context, s subscription) error {
+	app.restoreMu.RLock()
+	defer app.restoreMu.RUnlock()
+
+	seq, err := app.EventRepository.Cursor(ctx, s.consumer)
+	if err != nil {
+		return err
+	}
+
+	for {
+		events, err := app.EventRepository.After(ctx, seq, eventBatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		processed := seq
+		for _, event := range events {
+			err = s.handler(ctx, event)
+			if err != nil {
+				break
+			}
+			processed = event.Seq
+		}
+
+		// The events processed before a failure are not delivered again.
+		if processed > seq {
+			cursorErr := app.EventRepository.SetCursor(ctx, s.consumer, processed)
+			if cursorErr != nil {
+				return cursorErr
+			}
+			seq = processed
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// lowestCursor returns the Seq of the last event every subscriber has processed.
+// Events after it must be kept for the subscribers that have not processed them yet.
+func (app *App) lowestCursor(ctx context.Context) (int64, error) {
+	lowest, err := app.EventRepository.LastSeq(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, s := range app.subscriptions {
+		seq, err := app.EventRepository.Cursor(ctx, s.consumer)
+		if err != nil {
+			return 0, err
+		}
+		lowest = min(lowest, seq)
+	}
+	return lowest, nil
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/env"
+)
+
+func TestDeliverEventsAtLeastOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	open := func() *App {
+		app, err := New(&env.Env{DSN: path, DBMode: "wal"})
+		assertNoError(t, err)
+		return app
+	}
+	ctx := context.Background()
+
+	app := open()
+	for _, body := range []string{"first", "second", "third"} {
+		_, err := app.ChirpRepository.Create(ctx, database.CreateChirpParams{Body: body, UserID: "1"})
+		assertNoError(t, err)
+	}
+
+	var delivered []string
+	failed := false
+	handler := func(ctx context.Context, event database.Event) error {
+		if event.Chirp.Body == "second" && !failed {
+			failed = true
+			return errors.New("unavailable")
+		}
+		delivered = append(delivered, event.Chirp.Body)
+		return nil
+	}
+	s := subscription{consumer: "indexer", handler: handler}
+
+	// The failed event stops the delivery, and is the first one delivered on the next attempt.
+	err := app.deliverPendingEvents(ctx, s)
+	if err == nil {
+		t.Fatal("got no error from a failing handler")
+	}
+	assertNoError(t, app.deliverPendingEvents(ctx, s))
+	assertNoError(t, app.Close())
+
+	// The cursor survives a restart: only the events stored since are delivered.
+	app = open()
+	defer app.Close()
+	_, err = app.ChirpRepository.Create(ctx, database.CreateChirpParams{Body: "fourth", UserID: "1"})
+	assertNoError(t, err)
+	assertNoError(t, app.deliverPendingEvents(ctx, s))
+
+	want := []string{"first", "second", "third", "fourth"}
+	if !slices.Equal(delivered, want) {
+		t.Errorf("got: %v\nwant: %v", delivered, want)
+	}
+}
+
+// countingEventRepository counts the calls to SetCursor.
+type countingEventRepository struct {
+	database.EventRepository
+	setCursorCalls int
+}
+
+func (r *countingEventRepository) SetCursor(ctx context.Context, consumer string, seq int64) error {
+	r.setCursorCalls++
+	return r.EventRepository.SetCursor(ctx, consumer, seq)
+}
+
+func TestDeliverEventsSetsTheCursorOncePerBatch(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t)
+	for i := 0; i < eventBatchSize+1; i++ {
+		_, err := app.ChirpRepository.Create(ctx, database.CreateChirpParams{Body: "chirp", UserID: "1"})
+		assertNoError(t, err)
+	}
+
+	events := &countingEventRepository{EventRepository: app.EventRepository}
+	app.EventRepository = events
+	delivered := 0
+	s := subscription{consumer: "counter", handler: func(context.Context, database.Event) error {
+		delivered++
+		return nil
+	}}
+
+	assertNoError(t, app.deliverPendingEvents(ctx, s))
+	if delivered != eventBatchSize+1 || events.setCursorCalls != 2 {
+		t.Errorf("got %d events delivered and %d cursor updates, want %d and 2", delivered, events.setCursorCalls, eventBatchSize+1)
+	}
+}
+
+func TestTrimEventsKeepsUnprocessedEvents(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t)
+	app.Env.EventRetention = -time.Hour
+	app.subscriptions = nil
+	app.Subscribe("slow", func(context.Context, database.Event) error { return nil })
+
+	for i := 0; i < 3; i++ {
+		_, err := app.ChirpRepository.Create(ctx, database.CreateChirpParams{Body: "chirp", UserID: "1"})
+		assertNoError(t, err)
+	}
+	events, err := app.EventRepository.After(ctx, 0, 100)
+	assertNoError(t, err)
+	assertNoError(t, app.EventRepository.SetCursor(ctx, "slow", events[0].Seq))
+
+	trimmed, err := app.trimEvents(ctx)
+	assertNoError(t, err)
+	if trimmed != 1 {
+		t.Fatalf("got %d events trimmed, want only the one the subscriber processed", trimmed)
+	}
+
+	assertNoError(t, app.deliverPendingEvents(ctx, app.subscriptions[0]))
+	trimmed, err = app.trimEvents(ctx)
+	assertNoError(t, err)
+	if trimmed != 2 {
+		t.Errorf("got %d events trimmed once processed, want 2", trimmed)
+	}
+}
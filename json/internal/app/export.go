@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+// Formats supported by export and import, selected with the format query parameter.
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// exportPageSize is the number of rows an export reads from the database, and writes to the client, at a time.
+const exportPageSize = 500
+
+// ExportedUser is the public part of a database.User: exports never contain password hashes.
+type ExportedUser struct {
+	ID          string `json:"id"`
+	Email       string `json:"email"`
+	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Handle      string `json:"handle,omitempty"`
+	database.Profile
+}
+
+var (
+	exportedUserHeader = []string{
+		"id", "email", "is_chirpy_red", "handle", "display_name", "bio", "location", "website",
+	}
+	exportedChirpHeader = []string{"id", "body", "author_id"}
+)
+
+// ExportUsers streams every user, oldest first, as NDJSON or CSV.
+func (app *App) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	format, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+
+	page := func(ctx context.Context, after string) ([]ExportedUser, string, error) {
+		users, err := app.UserRepository.List(ctx, database.ListUsersParams{After: after, Limit: exportPageSize})
+		if err != nil || len(users) == 0 {
+			return nil, "", err
+		}
+
+		rows := make([]ExportedUser, 0, len(users))
+		for _, user := range users {
+			rows = append(rows, ExportedUser{
+				ID:          user.ID,
+				Email:       user.Email,
+				IsChirpyRed: user.IsChirpyRed,
+				Handle:      user.Handle,
+				Profile:     user.Profile,
+			})
+		}
+		return rows, users[len(users)-1].ID, nil
+	}
+
+	writeExport(w, r, format, "users", exportedUserHeader, page, func(user ExportedUser) []string {
+		return []string{
+			user.ID,
+			user.Email,
+			strconv.FormatBool(user.IsChirpyRed),
+			user.Handle,
+			user.DisplayName,
+			user.Bio,
+			user.Location,
+			user.Website,
+		}
+	})
+}
+
+// ExportChirps streams every chirp, oldest first, as NDJSON or CSV.
+func (app *App) ExportChirps(w http.ResponseWriter, r *http.Request) {
+	format, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+
+	page := func(ctx context.Context, after string) ([]database.Chirp, string, error) {
+		chirps, err := app.ChirpRepository.List(ctx, database.ListChirpsParams{After: after, Limit: exportPageSize})
+		if err != nil || len(chirps) == 0 {
+			return nil, "", err
+		}
+		return chirps, chirps[len(chirps)-1].ID, nil
+	}
+
+	writeExport(w, r, format, "chirps", exportedChirpHeader, page, func(chirp database.Chirp) []string {
+		return []string{chirp.ID, chirp.Body, chirp.UserID}
+	})
+}
+
+func exportFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		return FormatNDJSON, true
+	case FormatNDJSON, FormatCSV:
+		return format, true
+	default:
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %q", format))
+		return "", false
+	}
+}
+
+// writeExport streams rows to w, one JSON object per line or one CSV record per row after header.
+// page returns the rows after the cursor after, and the cursor of the next page. Each page is sent to the client
+// before the next one is read, so an export holds at most exportPageSize rows in memory.
+func writeExport[T any](
+	w http.ResponseWriter,
+	r *http.Request,
+	format string,
+	name string,
+	header []string,
+	page func(ctx context.Context, after string) (rows []T, next string, err error),
+	record func(T) []string,
+) {
+	rows, next, err := page(r.Context(), "")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to retrieve "+name)
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if format == FormatCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+	w.WriteHeader(http.StatusOK)
+
+	encode := newRowEncoder(w, format, header, record)
+	for {
+		err = encode(rows)
+		if err != nil {
+			// The client is gone: there is nobody left to tell.
+			return
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		if len(rows) < exportPageSize {
+			return
+		}
+
+		rows, next, err = page(r.Context(), next)
+		if err != nil {
+			// The status line is already sent: abort the response so that the client sees a failed
+			// transfer instead of an export that looks complete.
+			log.Printf("failed to export %s : %s", name, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// newRowEncoder returns a function that writes rows to w in format. CSV starts with header.
+func newRowEncoder[T any](w io.Writer, format string, header []string, record func(T) []string) func(rows []T) error {
+	if format == FormatNDJSON {
+		encoder := json.NewEncoder(w)
+		return func(rows []T) error {
+			for _, row := range rows {
+				err := encoder.Encode(row)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	// Errors stick to the writer: a failed header is reported by the Flush of the first page.
+	writer.Write(header)
+	return func(rows []T) error {
+		for _, row := range rows {
+			err := writer.Write(record(row))
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/handle"
+)
+
+// ErrFollowSelf is returned when users try to follow themselves.
+var ErrFollowSelf = errors.New("users cannot follow themselves")
+
+type JSONFollowRepository struct {
+	db *database.DB
+}
+
+func NewJSONFollowRepository(db *database.DB) *JSONFollowRepository {
+	return &JSONFollowRepository{db: db}
+}
+
+func (r *JSONFollowRepository) Follow(ctx context.Context, follow database.Follow) error {
+	return r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		_, followerOK := dbs.Users[follow.FollowerID]
+		_, followeeOK := dbs.Users[follow.FolloweeID]
+		if !followerOK || !followeeOK {
+			return ErrUserNotFound
+		}
+		if _, ok := dbs.Follows[follow.FollowerID][follow.FolloweeID]; ok {
+			return nil
+		}
+
+		dbs.PutFollow(follow)
+		dbs.AppendEvent(database.NewFollowEvent(database.EventUserFollowed, follow))
+		return nil
+	})
+}
+
+func (r *JSONFollowRepository) Unfollow(ctx context.Context, follow database.Follow) error {
+	return r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		if _, ok := dbs.Follows[follow.FollowerID][follow.FolloweeID]; !ok {
+			return nil
+		}
+
+		dbs.DeleteFollow(follow)
+		dbs.AppendEvent(database.NewFollowEvent(database.EventUserUnfollowed, follow))
+		return nil
+	})
+}
+
+func (r *JSONFollowRepository) CountFollowers(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		n = dbs.FollowerCount(userID)
+		return nil
+	})
+	return n, err
+}
+
+// followee returns the user with the handle URL parameter, who the user of the request wants to follow or unfollow.
+// It responds with an error and returns false if there is none.
+func (app *App) followee(w http.ResponseWriter, r *http.Request, user database.User) (database.User, bool) {
+	userHandle := handle.Normalize(chi.URLParam(r, "handle"))
+	if userHandle == "" {
+		respondWithError(w, http.StatusBadRequest, "missing url parameter")
+		return database.User{}, false
+	}
+
+	followee, err := app.UserRepository.GetByHandle(r.Context(), userHandle)
+	if err == ErrUserNotFound {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return database.User{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return database.User{}, false
+	}
+
+	if followee.ID == user.ID {
+		respondWithError(w, http.StatusBadRequest, ErrFollowSelf.Error())
+		return database.User{}, false
+	}
+	return followee, true
+}
+
+// FollowUser makes the user follow the user with the handle URL parameter.
+func (app *App) FollowUser(w http.ResponseWriter, r *http.Request, user database.User) {
+	followee, ok := app.followee(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := app.FollowRepository.Follow(r.Context(), database.Follow{FollowerID: user.ID, FolloweeID: followee.ID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to follow user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnfollowUser stops the user from following the user with the handle URL parameter.
+func (app *App) UnfollowUser(w http.ResponseWriter, r *http.Request, user database.User) {
+	followee, ok := app.followee(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := app.FollowRepository.Unfollow(r.Context(), database.Follow{FollowerID: user.ID, FolloweeID: followee.ID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to unfollow user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,319 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/handle"
+	"github.com/zoumas/chirpy/json/internal/hashtag"
+	"github.com/zoumas/chirpy/json/internal/id"
+)
+
+// maxImportSize bounds the size of the files of a single import request.
+const maxImportSize = 512 << 20
+
+// ImportReport describes the outcome of an import.
+type ImportReport struct {
+	Users  ImportResult `json:"users"`
+	Chirps ImportResult `json:"chirps"`
+}
+
+// ImportResult describes the outcome of importing one file.
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Failed   int `json:"failed"`
+	// IDs maps the ID of every imported row to the ID it was stored under.
+	IDs    map[string]string `json:"ids"`
+	Errors []ImportError     `json:"errors"`
+}
+
+// ImportError is the reason a row of an import file was skipped.
+type ImportError struct {
+	Line  int    `json:"line"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+func (result *ImportResult) fail(line int, rowID string, err error) {
+	result.Failed++
+	result.Errors = append(result.Errors, ImportError{Line: line, ID: rowID, Error: err.Error()})
+}
+
+func (result *ImportResult) succeed(rowID, storedID string) {
+	result.Imported++
+	result.IDs[rowID] = storedID
+}
+
+// ImportData imports users then chirps, in the format written by ExportUsers and ExportChirps.
+// Every row goes through the repositories and the same validation as the API; a row that fails
+// is reported and skipped instead of aborting the import.
+// Authors of chirps are resolved through the IDs of the users imported alongside them, or else as existing users.
+// Imported users have no password. Either reader may be nil.
+func (app *App) ImportData(ctx context.Context, users, chirps io.Reader, format string) (ImportReport, error) {
+	report := ImportReport{
+		Users:  ImportResult{IDs: map[string]string{}, Errors: []ImportError{}},
+		Chirps: ImportResult{IDs: map[string]string{}, Errors: []ImportError{}},
+	}
+
+	if users != nil {
+		err := readImport(users, format, exportedUserFromRecord, func(line int, row ExportedUser, err error) {
+			if err == nil {
+				err = app.importUser(ctx, &report.Users, row)
+			}
+			if err != nil {
+				report.Users.fail(line, row.ID, err)
+			}
+		})
+		if err != nil {
+			return report, fmt.Errorf("users : %s", err)
+		}
+	}
+
+	if chirps != nil {
+		err := readImport(chirps, format, chirpFromRecord, func(line int, row database.Chirp, err error) {
+			if err == nil {
+				err = app.importChirp(ctx, &report, row)
+			}
+			if err != nil {
+				report.Chirps.fail(line, row.ID, err)
+			}
+		})
+		if err != nil {
+			return report, fmt.Errorf("chirps : %s", err)
+		}
+	}
+
+	return report, nil
+}
+
+func (app *App) importUser(ctx context.Context, result *ImportResult, row ExportedUser) error {
+	// Handles are optional, as on POST /api/users.
+	userHandle := handle.Normalize(row.Handle)
+	var newHandle *string
+	if userHandle != "" {
+		newHandle = &userHandle
+	}
+	err := errors.Join(
+		validateHandle(newHandle),
+		validateProfileField("display_name", &row.DisplayName, maxDisplayNameLength),
+		validateProfileField("bio", &row.Bio, maxBioLength),
+		validateProfileField("location", &row.Location, maxLocationLength),
+		validateWebsite(&row.Website),
+	)
+	if err != nil {
+		return err
+	}
+
+	user, err := app.UserRepository.Create(ctx, database.CreateUserParams{
+		Email:  app.normalizeEmail(row.Email),
+		Handle: userHandle,
+	})
+	if err != nil {
+		return err
+	}
+
+	if row.Profile != (database.Profile{}) {
+		_, err = app.UserRepository.Update(ctx, user.ID, database.UpdateUserParams{
+			DisplayName: &row.DisplayName,
+			Bio:         &row.Bio,
+			Location:    &row.Location,
+			Website:     &row.Website,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if row.IsChirpyRed {
+		_, err = app.UserRepository.UpgradeToRed(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	result.succeed(row.ID, user.ID)
+	return nil
+}
+
+func (app *App) importChirp(ctx context.Context, report *ImportReport, row database.Chirp) error {
+	authorID, ok := report.Users.IDs[row.UserID]
+	if !ok {
+		author, err := app.UserRepository.GetByID(ctx, id.Normalize(row.UserID))
+		if err != nil {
+			return fmt.Errorf("unknown author %q", row.UserID)
+		}
+		authorID = author.ID
+	}
+
+	body, err := PrepareChirpBody(row.Body)
+	if err != nil {
+		return err
+	}
+
+	mentions, err := app.resolveMentions(ctx, body)
+	if err != nil {
+		return err
+	}
+
+	chirp, err := app.ChirpRepository.Create(ctx, database.CreateChirpParams{
+		Body:     body,
+		UserID:   authorID,
+		Hashtags: hashtag.Parse(body),
+		Mentions: mentions,
+	})
+	if err != nil {
+		return err
+	}
+
+	report.Chirps.succeed(row.ID, chirp.ID)
+	return nil
+}
+
+// readImport decodes every row of r and calls fn with its line number and either the row or the reason it could not be decoded.
+// It only returns an error when the file as a whole cannot be read.
+func readImport[T any](
+	r io.Reader,
+	format string,
+	fromRecord func(record map[string]string) (T, error),
+	fn func(line int, row T, err error),
+) error {
+	if format == FormatCSV {
+		return readCSV(r, fromRecord, fn)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var row T
+		err := json.Unmarshal(scanner.Bytes(), &row)
+		fn(line, row, err)
+	}
+	return scanner.Err()
+}
+
+func readCSV[T any](
+	r io.Reader,
+	fromRecord func(record map[string]string) (T, error),
+	fn func(line int, row T, err error),
+) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header : %s", err)
+	}
+
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		var row T
+		parseErr := &csv.ParseError{}
+		if errors.As(err, &parseErr) {
+			fn(parseErr.Line, row, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(fields) != len(header) {
+			fn(line, row, fmt.Errorf("got %d fields, want %d", len(fields), len(header)))
+			continue
+		}
+
+		record := make(map[string]string, len(header))
+		for i, column := range header {
+			record[column] = fields[i]
+		}
+		row, err = fromRecord(record)
+		fn(line, row, err)
+	}
+}
+
+func exportedUserFromRecord(record map[string]string) (ExportedUser, error) {
+	// Columns missing from files exported before they were added are left empty.
+	user := ExportedUser{
+		ID:     record["id"],
+		Email:  record["email"],
+		Handle: record["handle"],
+		Profile: database.Profile{
+			DisplayName: record["display_name"],
+			Bio:         record["bio"],
+			Location:    record["location"],
+			Website:     record["website"],
+		},
+	}
+	if value := record["is_chirpy_red"]; value != "" {
+		isChirpyRed, err := strconv.ParseBool(value)
+		if err != nil {
+			return user, fmt.Errorf("invalid is_chirpy_red %q", value)
+		}
+		user.IsChirpyRed = isChirpyRed
+	}
+	return user, nil
+}
+
+func chirpFromRecord(record map[string]string) (database.Chirp, error) {
+	return database.Chirp{ID: record["id"], Body: record["body"], UserID: record["author_id"]}, nil
+}
+
+// Import imports the users and chirps files of a multipart form, as exported by ExportUsers and ExportChirps,
+// and responds with an ImportReport.
+func (app *App) Import(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = FormatNDJSON
+	case FormatNDJSON, FormatCSV:
+	default:
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %q", format))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var files [2]io.Reader
+	for i, field := range []string{"users", "chirps"} {
+		f, _, err := r.FormFile(field)
+		if errors.Is(err, http.ErrMissingFile) {
+			continue
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer f.Close()
+		files[i] = f
+	}
+
+	report, err := app.ImportData(r.Context(), files[0], files[1], format)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatNDJSON, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			source := newTestApp(t)
+			alice, err := source.UserRepository.Create(context.Background(), database.CreateUserParams{Email: "alice@example.com", Password: "x", Handle: "alice"})
+			assertNoError(t, err)
+			_, err = source.UserRepository.UpgradeToRed(context.Background(), alice.ID)
+			assertNoError(t, err)
+			profile := database.Profile{DisplayName: "Alice", Bio: "Hello, \"world\"", Location: "Athens", Website: "https://example.com"}
+			_, err = source.UserRepository.Update(context.Background(), alice.ID, database.UpdateUserParams{
+				DisplayName: &profile.DisplayName,
+				Bio:         &profile.Bio,
+				Location:    &profile.Location,
+				Website:     &profile.Website,
+			})
+			assertNoError(t, err)
+			bob, err := source.UserRepository.Create(context.Background(), database.CreateUserParams{Email: "bob@example.com", Password: "x"})
+			assertNoError(t, err)
+			for _, chirp := range []database.CreateChirpParams{
+				{Body: "Hello, \"world\"", UserID: alice.ID},
+				{Body: "multi\nline, chirp", UserID: bob.ID},
+			} {
+				_, err := source.ChirpRepository.Create(context.Background(), chirp)
+				assertNoError(t, err)
+			}
+
+			users := export(t, source.ExportUsers, format)
+			chirps := export(t, source.ExportChirps, format)
+
+			target := newTestApp(t)
+			report, err := target.ImportData(context.Background(), users, chirps, format)
+			assertNoError(t, err)
+			if report.Users.Imported != 2 || report.Chirps.Imported != 2 {
+				t.Fatalf("imported %d users and %d chirps, want 2 and 2 : %+v", report.Users.Imported, report.Chirps.Imported, report)
+			}
+
+			user, err := target.UserRepository.GetByEmail(context.Background(), "alice@example.com")
+			assertNoError(t, err)
+			if user.ID != report.Users.IDs[alice.ID] || !user.IsChirpyRed || user.Handle != "alice" || user.Profile != profile {
+				t.Errorf("got %+v, want chirpy red user %q with handle alice and profile %+v", user, report.Users.IDs[alice.ID], profile)
+			}
+
+			imported, err := target.ChirpRepository.GetByUserID(context.Background(), report.Users.IDs[bob.ID])
+			assertNoError(t, err)
+			if len(imported) != 1 || imported[0].Body != "multi\nline, chirp" {
+				t.Errorf("got %+v, want bob's chirp", imported)
+			}
+		})
+	}
+}
+
+func TestExportStreamsEveryPage(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.UserRepository.Create(context.Background(), database.CreateUserParams{Email: "user@example.com"})
+	assertNoError(t, err)
+	for i := 0; i < exportPageSize+1; i++ {
+		_, err := app.ChirpRepository.Create(context.Background(), database.CreateChirpParams{Body: "Hello", UserID: user.ID})
+		assertNoError(t, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(export(t, app.ExportChirps, FormatCSV).String()), "\n")
+	if len(lines) != exportPageSize+2 {
+		t.Fatalf("got %d lines, want a header and %d chirps", len(lines), exportPageSize+1)
+	}
+	if !slices.IsSorted(lines[1:]) {
+		t.Error("chirps are not exported oldest first")
+	}
+}
+
+func TestImportReportsInvalidRows(t *testing.T) {
+	app := newTestApp(t)
+
+	users := strings.Join([]string{
+		`{"id":"1","email":"alice@example.com"}`,
+		`{"id":"2","email":"ALICE@example.com"}`,
+		`not json`,
+		`{"id":"4","email":"carol@example.com","handle":"no"}`,
+		`{"id":"5","email":"dave@example.com","website":"javascript:alert(1)"}`,
+	}, "\n")
+	chirps := strings.Join([]string{
+		`{"id":"1","body":"hello","author_id":"1"}`,
+		`{"id":"2","body":"","author_id":"1"}`,
+		`{"id":"3","body":"hello","author_id":"404"}`,
+	}, "\n")
+
+	report, err := app.ImportData(context.Background(), strings.NewReader(users), strings.NewReader(chirps), FormatNDJSON)
+	assertNoError(t, err)
+
+	for _, test := range []struct {
+		Desc        string
+		Result      ImportResult
+		Imported    int
+		FailedLines []int
+	}{
+		{Desc: "users", Result: report.Users, Imported: 1, FailedLines: []int{2, 3, 4, 5}},
+		{Desc: "chirps", Result: report.Chirps, Imported: 1, FailedLines: []int{2, 3}},
+	} {
+		t.Run(test.Desc, func(t *testing.T) {
+			if test.Result.Imported != test.Imported || test.Result.Failed != len(test.FailedLines) {
+				t.Fatalf("got %+v, want %d imported and failures on lines %v", test.Result, test.Imported, test.FailedLines)
+			}
+			for i, line := range test.FailedLines {
+				if test.Result.Errors[i].Line != line {
+					t.Errorf("got failure on line %d, want %d", test.Result.Errors[i].Line, line)
+				}
+			}
+		})
+	}
+}
+
+func export(t *testing.T, handler http.HandlerFunc, format string) *bytes.Buffer {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/?format="+format, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("export responded with %d : %s", w.Code, w.Body)
+	}
+	return w.Body
+}
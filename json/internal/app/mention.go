@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/mention"
+)
+
+// resolveMentions resolves the @handles of body to the users who have them now.
+// Handles no user has, previous handles included, are not mentions: they stay plain text.
+func (app *App) resolveMentions(ctx context.Context, body string) ([]database.Mention, error) {
+	var mentions []database.Mention
+	// userIDs caches the user of every handle looked up, or "" for unknown handles.
+	userIDs := map[string]string{}
+
+	for _, match := range mention.Parse(body) {
+		userID, ok := userIDs[match.Handle]
+		if !ok {
+			user, err := app.UserRepository.GetByHandle(ctx, match.Handle)
+			if err != nil && err != ErrUserNotFound {
+				return nil, err
+			}
+			if err == nil && user.Handle == match.Handle {
+				userID = user.ID
+			}
+			userIDs[match.Handle] = userID
+		}
+
+		if userID != "" {
+			mentions = append(mentions, database.Mention{
+				UserID: userID,
+				Handle: match.Handle,
+				Start:  match.Start,
+				End:    match.End,
+			})
+		}
+	}
+	return mentions, nil
+}
+
+// GetMentions responds with a page of the chirps that mention the user, sorted by creation time.
+func (app *App) GetMentions(w http.ResponseWriter, r *http.Request, user database.User) {
+	app.getChirpsPage(w, r, database.ListChirpsParams{MentionedUserID: user.ID})
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+func TestMentions(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t)
+
+	createUser := func(email, userHandle string) database.User {
+		t.Helper()
+
+		user, err := app.UserRepository.Create(ctx, database.CreateUserParams{Email: email, Handle: userHandle})
+		assertNoError(t, err)
+		return user
+	}
+	alice := createUser("alice@example.com", "alice")
+	bob := createUser("bob@example.com", "bob")
+	carol := createUser("carol@example.com", "carol")
+	newHandle := "caroline"
+	carol, err := app.UserRepository.Update(ctx, carol.ID, database.UpdateUserParams{Handle: &newHandle})
+	assertNoError(t, err)
+
+	body := "hi @Bob, @nobody and @carol! cc @caroline"
+	w := httptest.NewRecorder()
+	app.CreateChirp(w, httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body": "`+body+`"}`)), alice)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusCreated, w.Body)
+	}
+	chirp := database.Chirp{}
+	assertNoError(t, json.NewDecoder(w.Body).Decode(&chirp))
+
+	// Unknown and previous handles stay plain text.
+	want := []database.Mention{
+		{UserID: bob.ID, Handle: "bob", Start: 3, End: 7},
+		{UserID: carol.ID, Handle: "caroline", Start: 32, End: 41},
+	}
+	if !reflect.DeepEqual(chirp.Mentions, want) {
+		t.Fatalf("\ngot: %+v\nwant: %+v", chirp.Mentions, want)
+	}
+	for _, mention := range chirp.Mentions {
+		if got := chirp.Body[mention.Start:mention.End]; !strings.EqualFold(got, "@"+mention.Handle) {
+			t.Errorf("got %q at the offsets of the mention of %q", got, mention.Handle)
+		}
+	}
+
+	for _, test := range []struct {
+		User database.User
+		Want []string
+	}{
+		{User: bob, Want: []string{chirp.ID}},
+		{User: carol, Want: []string{chirp.ID}},
+		{User: alice, Want: []string{}},
+	} {
+		w := httptest.NewRecorder()
+		app.GetMentions(w, httptest.NewRequest(http.MethodGet, "/api/users/me/mentions", nil), test.User)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		page := struct {
+			Chirps []database.Chirp `json:"chirps"`
+		}{}
+		assertNoError(t, json.NewDecoder(w.Body).Decode(&page))
+		got := []string{}
+		for _, chirp := range page.Chirps {
+			got = append(got, chirp.ID)
+		}
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("mentions of %s:\ngot: %v\nwant: %v", test.User.Handle, got, test.Want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/zoumas/chirpy/json/internal/id"
+)
+
+const (
+	// defaultPageSize is the number of chirps in a page when the limit query parameter is missing.
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidLimit  = fmt.Errorf("limit must be a number between 1 and %d", maxPageSize)
+)
+
+// encodeCursor returns the cursor of the page that follows the chirp with the given ID.
+// Cursors are opaque to clients so that what they hold can change.
+func encodeCursor(lastID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(lastID))
+}
+
+// decodeCursor returns the ID of the last chirp of the page before cursor. An empty cursor is the first page.
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !id.Valid(string(data)) {
+		return "", ErrInvalidCursor
+	}
+	return string(data), nil
+}
+
+// parseLimit parses the limit query parameter, which defaults to defaultPageSize.
+func parseLimit(value string) (int, error) {
+	if value == "" {
+		return defaultPageSize, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, ErrInvalidLimit
+	}
+	return limit, nil
+}
+
+// nextLink returns the value of the Link header pointing to the page of u that starts at cursor.
+func nextLink(u *url.URL, cursor string) string {
+	query := u.Query()
+	query.Set("cursor", cursor)
+	next := url.URL{Path: u.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf(`<%s>; rel="next"`, next.String())
+}
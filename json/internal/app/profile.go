@@ -0,0 +1,112 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/handle"
+)
+
+// Maximum lengths of the profile fields, in characters.
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxLocationLength    = 30
+	maxWebsiteLength     = 100
+)
+
+// ErrInvalidWebsite is returned for websites that are not absolute http or https URLs.
+var ErrInvalidWebsite = errors.New("website must be an http or https URL")
+
+// validateHandle checks that userHandle, the new normalized handle of a user if not nil, can be taken.
+func validateHandle(userHandle *string) error {
+	if userHandle == nil {
+		return nil
+	}
+	return handle.Validate(*userHandle)
+}
+
+// validateProfileField checks that value, the new value of the profile field name if not nil, is at most max characters long.
+func validateProfileField(name string, value *string, max int) error {
+	if value != nil && utf8.RuneCountInString(*value) > max {
+		return fmt.Errorf("%s must be at most %d characters long", name, max)
+	}
+	return nil
+}
+
+// validateWebsite checks that website, if not nil or empty, is an absolute http or https URL.
+func validateWebsite(website *string) error {
+	err := validateProfileField("website", website, maxWebsiteLength)
+	if err != nil || website == nil || *website == "" {
+		return err
+	}
+
+	u, err := url.Parse(*website)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebsite
+	}
+	return nil
+}
+
+// PublicProfile is what anyone can see about a user.
+type PublicProfile struct {
+	ID     string `json:"id"`
+	Handle string `json:"handle"`
+	database.Profile
+	IsChirpyRed   bool `json:"is_chirpy_red"`
+	ChirpCount    int  `json:"chirp_count"`
+	FollowerCount int  `json:"follower_count"`
+}
+
+// GetUserProfile responds with the public profile of the user with the handle URL parameter.
+// A previous handle redirects to the current one, until another user takes it.
+func (app *App) GetUserProfile(w http.ResponseWriter, r *http.Request) {
+	userHandle := handle.Normalize(chi.URLParam(r, "handle"))
+	if userHandle == "" {
+		respondWithError(w, http.StatusBadRequest, "missing url parameter")
+		return
+	}
+
+	user, err := app.UserRepository.GetByHandle(r.Context(), userHandle)
+	if err == ErrUserNotFound {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Not permanent: the previous handle can be taken by another user.
+	if user.Handle != userHandle {
+		http.Redirect(w, r, path.Join(path.Dir(r.URL.Path), user.Handle), http.StatusFound)
+		return
+	}
+
+	chirps, err := app.ChirpRepository.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to retrieve chirps")
+		return
+	}
+
+	followers, err := app.FollowRepository.CountFollowers(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to count followers")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, PublicProfile{
+		ID:            user.ID,
+		Handle:        user.Handle,
+		Profile:       user.Profile,
+		IsChirpyRed:   user.IsChirpyRed,
+		ChirpCount:    len(chirps),
+		FollowerCount: followers,
+	})
+}
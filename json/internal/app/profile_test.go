@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zoumas/chirpy/json/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestProfiles(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t)
+	app.Env.HandleChangeInterval = time.Hour
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assertNoError(t, err)
+	user, err := app.UserRepository.Create(ctx, database.CreateUserParams{
+		Email:    "user@example.com",
+		Password: string(hashedPassword),
+		Handle:   "zoumas",
+	})
+	assertNoError(t, err)
+	_, err = app.ChirpRepository.Create(ctx, database.CreateChirpParams{Body: "Hello", UserID: user.ID})
+	assertNoError(t, err)
+
+	updateUser := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		current, err := app.UserRepository.GetByID(ctx, user.ID)
+		assertNoError(t, err)
+		w := httptest.NewRecorder()
+		app.UpdateUser(w, httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(body)), current)
+		return w
+	}
+	getProfile := func(userHandle string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "/api/users/"+userHandle, nil)
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("handle", userHandle)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx))
+
+		w := httptest.NewRecorder()
+		app.GetUserProfile(w, r)
+		return w
+	}
+
+	t.Run("invalid fields", func(t *testing.T) {
+		for _, body := range []string{
+			`{"email": "user@example.com", "handle": "no"}`,
+			`{"email": "user@example.com", "bio": "` + strings.Repeat("a", maxBioLength+1) + `"}`,
+			`{"email": "user@example.com", "website": "javascript:alert(1)"}`,
+			`{"email": "", "bio": "hi"}`,
+			`{"password": ""}`,
+		} {
+			if w := updateUser(body); w.Code != http.StatusBadRequest {
+				t.Errorf("%s : got status %d, want %d", body, w.Code, http.StatusBadRequest)
+			}
+		}
+	})
+
+	t.Run("profile only update keeps the credentials", func(t *testing.T) {
+		w := updateUser(`{"bio": "hi"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		login := func(body string) int {
+			w := httptest.NewRecorder()
+			app.Login(w, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body)))
+			return w.Code
+		}
+		if code := login(`{"email": "user@example.com", "password": "secret"}`); code != http.StatusOK {
+			t.Errorf("got status %d logging in with the old credentials, want %d", code, http.StatusOK)
+		}
+		if code := login(`{"email": "", "password": ""}`); code != http.StatusUnauthorized {
+			t.Errorf("got status %d logging in with empty credentials, want %d", code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("public profile", func(t *testing.T) {
+		w := updateUser(`{"email": "user@example.com", "display_name": "Zoumas", "website": "https://example.com"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		w = getProfile("@Zoumas")
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusOK, w.Body)
+		}
+		if strings.Contains(w.Body.String(), "user@example.com") {
+			t.Errorf("the public profile exposes the email : %s", w.Body)
+		}
+
+		got := PublicProfile{}
+		assertNoError(t, json.NewDecoder(w.Body).Decode(&got))
+		want := PublicProfile{
+			ID:         user.ID,
+			Handle:     "zoumas",
+			Profile:    database.Profile{DisplayName: "Zoumas", Bio: "hi", Website: "https://example.com"},
+			ChirpCount: 1,
+		}
+		if got != want {
+			t.Errorf("got: %+v\nwant: %+v", got, want)
+		}
+
+		if w := getProfile("nobody"); w.Code != http.StatusNotFound {
+			t.Errorf("got status %d for an unknown handle, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("followers", func(t *testing.T) {
+		fan, err := app.UserRepository.Create(ctx, database.CreateUserParams{
+			Email:    "fan@example.com",
+			Password: string(hashedPassword),
+			Handle:   "fan",
+		})
+		assertNoError(t, err)
+
+		follow := func(method string, follower database.User, userHandle string) int {
+			t.Helper()
+
+			r := httptest.NewRequest(method, "/api/users/"+userHandle+"/follow", nil)
+			routeCtx := chi.NewRouteContext()
+			routeCtx.URLParams.Add("handle", userHandle)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx))
+
+			w := httptest.NewRecorder()
+			if method == http.MethodDelete {
+				app.UnfollowUser(w, r, follower)
+			} else {
+				app.FollowUser(w, r, follower)
+			}
+			return w.Code
+		}
+		followers := func() int {
+			t.Helper()
+
+			w := getProfile("zoumas")
+			got := PublicProfile{}
+			assertNoError(t, json.NewDecoder(w.Body).Decode(&got))
+			return got.FollowerCount
+		}
+
+		for _, test := range []struct {
+			Desc      string
+			Method    string
+			Handle    string
+			Status    int
+			Followers int
+		}{
+			{Desc: "follow", Method: http.MethodPost, Handle: "zoumas", Status: http.StatusNoContent, Followers: 1},
+			{Desc: "follow again", Method: http.MethodPost, Handle: "@Zoumas", Status: http.StatusNoContent, Followers: 1},
+			{Desc: "follow yourself", Method: http.MethodPost, Handle: "fan", Status: http.StatusBadRequest, Followers: 1},
+			{Desc: "follow an unknown user", Method: http.MethodPost, Handle: "nobody", Status: http.StatusNotFound, Followers: 1},
+			{Desc: "unfollow", Method: http.MethodDelete, Handle: "zoumas", Status: http.StatusNoContent, Followers: 0},
+		} {
+			if got := follow(test.Method, fan, test.Handle); got != test.Status {
+				t.Errorf("%s : got status %d, want %d", test.Desc, got, test.Status)
+			}
+			if got := followers(); got != test.Followers {
+				t.Errorf("%s : got %d followers, want %d", test.Desc, got, test.Followers)
+			}
+		}
+	})
+
+	t.Run("handle changes", func(t *testing.T) {
+		w := updateUser(`{"email": "user@example.com", "handle": "chirper"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		w = getProfile("zoumas")
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "/api/users/chirper" {
+			t.Errorf("got status %d to %q, want %d to /api/users/chirper", w.Code, w.Header().Get("Location"), http.StatusFound)
+		}
+
+		w = updateUser(`{"email": "user@example.com", "handle": "again"}`)
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Errorf("got status %d with Retry-After %q, want %d with a delay", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+		}
+	})
+}
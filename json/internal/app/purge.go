@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// purgeInterval is how often deleted chirps and events past their retention window are purged.
+const purgeInterval = 10 * time.Minute
+
+// PurgeExpired permanently removes the chirps deleted longer than Env.ChirpRetention ago
+// and the events older than Env.EventRetention that every subscriber has processed,
+// once right away then every purgeInterval, until ctx is done.
+func (app *App) PurgeExpired(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := app.ChirpRepository.Purge(ctx, time.Now().Add(-app.Env.ChirpRetention))
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.Printf("failed to purge deleted chirps : %s", err)
+		case purged > 0:
+			log.Printf("purged %d deleted chirps", purged)
+		}
+
+		trimmed, err := app.trimEvents(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.Printf("failed to trim events : %s", err)
+		case trimmed > 0:
+			log.Printf("trimmed %d events", trimmed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// trimEvents removes the events older than Env.EventRetention that every subscriber has processed.
+func (app *App) trimEvents(ctx context.Context) (int, error) {
+	maxSeq, err := app.lowestCursor(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return app.EventRepository.Trim(ctx, time.Now().Add(-app.Env.EventRetention), maxSeq)
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/database/databasetest"
+)
+
+func TestJSONRepositories(t *testing.T) {
+	for _, test := range []struct {
+		Desc    string
+		Options database.Options
+	}{
+		{Desc: "synchronous", Options: database.Options{}},
+		{Desc: "flush interval", Options: database.Options{FlushInterval: time.Hour}},
+		{Desc: "write-ahead log", Options: database.Options{WAL: true}},
+	} {
+		t.Run(test.Desc, func(t *testing.T) {
+			databasetest.RunSuite(t, func(t *testing.T) databasetest.Repositories {
+				db, err := database.New(filepath.Join(t.TempDir(), "database.json"), test.Options)
+				assertNoError(t, err)
+				t.Cleanup(func() { db.Close() })
+
+				return databasetest.Repositories{
+					Chirps:        NewJSONChirpResository(db),
+					Users:         NewJSONUserRepository(db),
+					RevokedTokens: NewJSONRevokedTokensRepository(db),
+					Events:        NewJSONEventRepository(db),
+					Follows:       NewJSONFollowRepository(db),
+				}
+			})
+		})
+	}
+}
+
+func TestMemoryRepositories(t *testing.T) {
+	databasetest.RunSuite(t, func(t *testing.T) databasetest.Repositories {
+		db := database.NewMemory()
+		t.Cleanup(func() { db.Close() })
+
+		return databasetest.Repositories{
+			Chirps:        NewJSONChirpResository(db),
+			Users:         NewJSONUserRepository(db),
+			RevokedTokens: NewJSONRevokedTokensRepository(db),
+			Events:        NewJSONEventRepository(db),
+			Follows:       NewJSONFollowRepository(db),
+		}
+	})
+}
+
+func TestSQLiteRepositories(t *testing.T) {
+	databasetest.RunSuite(t, func(t *testing.T) databasetest.Repositories {
+		db, err := database.NewSQLite(filepath.Join(t.TempDir(), "database.db"))
+		assertNoError(t, err)
+		t.Cleanup(func() { db.Close() })
+
+		return databasetest.Repositories{
+			Chirps:        NewSQLiteChirpRepository(db),
+			Users:         NewSQLiteUserRepository(db),
+			RevokedTokens: NewSQLiteRevokedTokensRepository(db),
+			Events:        NewSQLiteEventRepository(db),
+			Follows:       NewSQLiteFollowRepository(db),
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/zoumas/chirpy/json/internal/database"
@@ -14,34 +15,29 @@ func NewJSONRevokedTokensRepository(db *database.DB) *JSONRevokedTokensRepositor
 	return &JSONRevokedTokensRepository{db: db}
 }
 
-func (r *JSONRevokedTokensRepository) Revoke(token string) error {
-	dbs, err := r.db.Load()
-	if err != nil {
-		return err
-	}
-
-	dbs.RevokedTokens[token] = struct{}{}
+func (r *JSONRevokedTokensRepository) Revoke(ctx context.Context, token string) error {
+	return r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		if _, ok := dbs.RevokedTokens[token]; ok {
+			return nil
+		}
 
-	err = r.db.Persist(dbs)
-	if err != nil {
-		return err
-	}
-
-	return nil
+		dbs.RevokeToken(token)
+		dbs.AppendEvent(database.NewTokenRevokedEvent(token))
+		return nil
+	})
 }
 
-func (r *JSONRevokedTokensRepository) IsRevoked(token string) (bool, error) {
-	dbs, err := r.db.Load()
-	if err != nil {
-		return false, err
-	}
-
-	_, ok := dbs.RevokedTokens[token]
-	return ok, nil
+func (r *JSONRevokedTokensRepository) IsRevoked(ctx context.Context, token string) (bool, error) {
+	var ok bool
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		_, ok = dbs.RevokedTokens[token]
+		return nil
+	})
+	return ok, err
 }
 
 func (app *App) Revoke(w http.ResponseWriter, r *http.Request, params WithRefreshTokenParams) {
-	err := app.RevokedTokensRepository.Revoke(params.token)
+	err := app.RevokedTokensRepository.Revoke(r.Context(), params.token)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -51,7 +47,7 @@ func (app *App) Revoke(w http.ResponseWriter, r *http.Request, params WithRefres
 }
 
 func (app *App) Refresh(w http.ResponseWriter, r *http.Request, params WithRefreshTokenParams) {
-	ok, err := app.RevokedTokensRepository.IsRevoked(params.token)
+	ok, err := app.RevokedTokensRepository.IsRevoked(r.Context(), params.token)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
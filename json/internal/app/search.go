@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/search"
+)
+
+// searchConsumer is the name the search index consumes the event stream under.
+const searchConsumer = "search"
+
+// buildSearchIndex indexes every chirp, then subscribes the index to the chirp events to keep it up to date.
+// The index is built again when the database is restored.
+func (app *App) buildSearchIndex(ctx context.Context) error {
+	app.SearchIndex = search.NewIndex()
+	err := app.indexChirps(ctx)
+	if err != nil {
+		return err
+	}
+
+	app.Subscribe(searchConsumer, app.indexChirpEvent)
+	app.OnRestore(app.indexChirps)
+	return nil
+}
+
+// indexChirps replaces the content of the search index with every chirp, and moves the cursor of the index
+// to the last event. The events stored while the chirps are read are delivered again, which is harmless:
+// indexing is idempotent.
+func (app *App) indexChirps(ctx context.Context) error {
+	seq, err := app.EventRepository.LastSeq(ctx)
+	if err != nil {
+		return err
+	}
+
+	chirps, err := app.ChirpRepository.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	index := search.NewIndex()
+	for _, chirp := range chirps {
+		index.Put(chirp.ID, chirp.Body)
+	}
+
+	err = app.EventRepository.SetCursor(ctx, searchConsumer, seq)
+	if err != nil {
+		return err
+	}
+	app.SearchIndex.ReplaceWith(index)
+	return nil
+}
+
+// indexChirpEvent applies a chirp event to the search index.
+func (app *App) indexChirpEvent(_ context.Context, event database.Event) error {
+	switch event.Type {
+	case database.EventChirpCreated, database.EventChirpRestored:
+		app.SearchIndex.Put(event.Chirp.ID, event.Chirp.Body)
+	case database.EventChirpDeleted:
+		app.SearchIndex.Remove(event.Chirp.ID)
+	}
+	return nil
+}
+
+// SearchChirps responds with the chirps that match the query parameter q, the most relevant first,
+// and the newest first among equally relevant ones. The number of chirps is bounded by the limit query parameter.
+func (app *App) SearchChirps(w http.ResponseWriter, r *http.Request) {
+	query, err := search.ParseQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hits := app.SearchIndex.Search(query, limit)
+	chirps := make([]database.Chirp, 0, len(hits))
+	for _, hit := range hits {
+		chirp, err := app.ChirpRepository.GetByID(r.Context(), hit.ID)
+		// The chirp was deleted since it was indexed.
+		if errors.Is(err, ErrChirpNotFound) {
+			continue
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "failed to retrieve chirps")
+			return
+		}
+		chirps = append(chirps, chirp)
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/search"
+)
+
+func TestSearchChirps(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t)
+	indexed, err := app.ChirpRepository.Create(ctx, database.CreateChirpParams{Body: "Indexed on startup", UserID: "1"})
+	assertNoError(t, err)
+	// Rebuilding the index must pick up the chirps already in the store.
+	app.subscriptions = nil
+	assertNoError(t, app.buildSearchIndex(ctx))
+
+	first, err := app.ChirpRepository.Create(ctx, database.CreateChirpParams{Body: "Running late again", UserID: "1"})
+	assertNoError(t, err)
+	second, err := app.ChirpRepository.Create(ctx, database.CreateChirpParams{Body: "Run every morning", UserID: "1"})
+	assertNoError(t, err)
+	assertNoError(t, app.deliverPendingEvents(ctx, app.subscriptions[0]))
+
+	searchIDs := func(q string) []string {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		app.SearchChirps(w, httptest.NewRequest(http.MethodGet, "/api/chirps/search?q="+url.QueryEscape(q), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s : got status %d, want %d : %s", q, w.Code, http.StatusOK, w.Body)
+		}
+
+		chirps := []database.Chirp{}
+		assertNoError(t, json.NewDecoder(w.Body).Decode(&chirps))
+		return chirpIDs(chirps)
+	}
+	assertIDs := func(got, want []string) {
+		t.Helper()
+
+		if !slices.Equal(got, want) {
+			t.Errorf("got: %v\nwant: %v", got, want)
+		}
+	}
+
+	assertIDs(searchIDs("startup"), []string{indexed.ID})
+	// As relevant as each other: the newest comes first.
+	assertIDs(searchIDs("runs"), []string{second.ID, first.ID})
+	assertIDs(searchIDs("run -late"), []string{second.ID})
+
+	assertNoError(t, app.ChirpRepository.Delete(ctx, database.DeleteChirpParams{ID: second.ID, UserID: "1"}))
+	assertNoError(t, app.deliverPendingEvents(ctx, app.subscriptions[0]))
+	assertIDs(searchIDs("runs"), []string{first.ID})
+
+	w := httptest.NewRecorder()
+	app.SearchChirps(w, httptest.NewRequest(http.MethodGet, "/api/chirps/search?q=%28run", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d for an invalid query, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSearchIndexIsRebuiltOnRestore(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t)
+	chirp, err := app.ChirpRepository.Create(ctx, database.CreateChirpParams{Body: "Backed up", UserID: "1"})
+	assertNoError(t, err)
+	assertNoError(t, app.deliverPendingEvents(ctx, app.subscriptions[0]))
+
+	backup := bytes.Buffer{}
+	assertNoError(t, app.DB.Backup(&backup))
+	assertNoError(t, app.ChirpRepository.Delete(ctx, database.DeleteChirpParams{ID: chirp.ID, UserID: "1"}))
+	assertNoError(t, app.deliverPendingEvents(ctx, app.subscriptions[0]))
+
+	indexed := func() []string {
+		t.Helper()
+
+		query, err := search.ParseQuery("backed")
+		assertNoError(t, err)
+		ids := []string{}
+		for _, hit := range app.SearchIndex.Search(query, 10) {
+			ids = append(ids, hit.ID)
+		}
+		return ids
+	}
+	if got := indexed(); len(got) != 0 {
+		t.Fatalf("got %v before the restore, want nothing", got)
+	}
+
+	w := httptest.NewRecorder()
+	app.Restore(w, httptest.NewRequest(http.MethodPost, "/admin/restore", &backup))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusOK, w.Body)
+	}
+	// The events of the restored database do not undo the rebuild.
+	assertNoError(t, app.deliverPendingEvents(ctx, app.subscriptions[0]))
+
+	if got := indexed(); !slices.Equal(got, []string{chirp.ID}) {
+		t.Errorf("got: %v\nwant: [%s]", got, chirp.ID)
+	}
+}
+
+func chirpIDs(chirps []database.Chirp) []string {
+	ids := make([]string, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	return ids
+}
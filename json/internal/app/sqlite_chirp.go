@@ -0,0 +1,305 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/id"
+)
+
+type SQLiteChirpRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteChirpRepository(db *sql.DB) *SQLiteChirpRepository {
+	return &SQLiteChirpRepository{db: db}
+}
+
+func (r *SQLiteChirpRepository) Create(ctx context.Context, params database.CreateChirpParams) (database.Chirp, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	chirp := database.Chirp{
+		ID:       id.New(),
+		Body:     params.Body,
+		UserID:   params.UserID,
+		Hashtags: params.Hashtags,
+		Mentions: params.Mentions,
+		Version:  1,
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO chirps (id, body, author_id, hashtags, mentions) VALUES (?, ?, ?, ?, ?)",
+		chirp.ID,
+		chirp.Body,
+		chirp.UserID,
+		strings.Join(chirp.Hashtags, " "),
+		mentionsColumn{&chirp.Mentions},
+	)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	for _, tag := range chirp.Hashtags {
+		_, err = tx.ExecContext(ctx, "INSERT INTO chirp_hashtags (hashtag, chirp_id) VALUES (?, ?)", tag, chirp.ID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+
+	for _, mention := range chirp.Mentions {
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT OR IGNORE INTO chirp_mentions (user_id, chirp_id) VALUES (?, ?)",
+			mention.UserID,
+			chirp.ID,
+		)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+
+	err = appendEvent(ctx, tx, database.NewChirpEvent(database.EventChirpCreated, chirp))
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return chirp, tx.Commit()
+}
+
+func (r *SQLiteChirpRepository) GetAll(ctx context.Context) ([]database.Chirp, error) {
+	return r.query(ctx, "SELECT id, body, author_id, hashtags, mentions, version FROM chirps WHERE deleted_at IS NULL")
+}
+
+func (r *SQLiteChirpRepository) GetByUserID(ctx context.Context, userID string) ([]database.Chirp, error) {
+	return r.query(
+		ctx,
+		"SELECT id, body, author_id, hashtags, mentions, version FROM chirps WHERE author_id = ? AND deleted_at IS NULL",
+		userID,
+	)
+}
+
+func (r *SQLiteChirpRepository) List(ctx context.Context, params database.ListChirpsParams) ([]database.Chirp, error) {
+	query := "SELECT id, body, author_id, hashtags, mentions, version FROM chirps WHERE deleted_at IS NULL"
+	args := []any{}
+
+	if params.AuthorID != "" {
+		query += " AND author_id = ?"
+		args = append(args, params.AuthorID)
+	}
+	if params.Hashtag != "" {
+		query += " AND id IN (SELECT chirp_id FROM chirp_hashtags WHERE hashtag = ?)"
+		args = append(args, params.Hashtag)
+	}
+	if params.MentionedUserID != "" {
+		query += " AND id IN (SELECT chirp_id FROM chirp_mentions WHERE user_id = ?)"
+		args = append(args, params.MentionedUserID)
+	}
+
+	order := "ASC"
+	if params.Desc {
+		order = "DESC"
+	}
+	if params.After != "" {
+		if params.Desc {
+			query += " AND id < ?"
+		} else {
+			query += " AND id > ?"
+		}
+		args = append(args, params.After)
+	}
+
+	query += " ORDER BY id " + order + " LIMIT ?"
+	args = append(args, params.Limit)
+	return r.query(ctx, query, args...)
+}
+
+func (r *SQLiteChirpRepository) GetByID(ctx context.Context, id string) (database.Chirp, error) {
+	chirp := database.Chirp{}
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT id, body, author_id, hashtags, mentions, version FROM chirps WHERE id = ? AND deleted_at IS NULL",
+		id,
+	).Scan(&chirp.ID, &chirp.Body, &chirp.UserID, hashtagsColumn{&chirp.Hashtags}, mentionsColumn{&chirp.Mentions}, &chirp.Version)
+	if err == sql.ErrNoRows {
+		return database.Chirp{}, ErrChirpNotFound
+	}
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return chirp, nil
+}
+
+func (r *SQLiteChirpRepository) Delete(ctx context.Context, params database.DeleteChirpParams) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	chirp := database.Chirp{}
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT id, body, author_id, hashtags, mentions, version FROM chirps WHERE id = ? AND deleted_at IS NULL",
+		params.ID,
+	).Scan(&chirp.ID, &chirp.Body, &chirp.UserID, hashtagsColumn{&chirp.Hashtags}, mentionsColumn{&chirp.Mentions}, &chirp.Version)
+	if err == sql.ErrNoRows {
+		return ErrChirpNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if chirp.UserID != params.UserID {
+		return ErrChirpNotAuthor
+	}
+
+	if !params.IfVersions.Match(chirp.Version) {
+		return ErrChirpVersionMismatch
+	}
+
+	deletedAt := time.Now().UTC()
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE chirps SET deleted_at = ?, version = version + 1 WHERE id = ?",
+		deletedAt,
+		params.ID,
+	)
+	if err != nil {
+		return err
+	}
+	chirp.DeletedAt = &deletedAt
+	chirp.Version++
+
+	err = appendEvent(ctx, tx, database.NewChirpEvent(database.EventChirpDeleted, chirp))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteChirpRepository) Restore(
+	ctx context.Context,
+	params database.RestoreChirpParams,
+) (database.Chirp, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	chirp := database.Chirp{}
+	var deletedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, "SELECT id, body, author_id, hashtags, mentions, version, deleted_at FROM chirps WHERE id = ?", params.ID).
+		Scan(&chirp.ID, &chirp.Body, &chirp.UserID, hashtagsColumn{&chirp.Hashtags}, mentionsColumn{&chirp.Mentions}, &chirp.Version, &deletedAt)
+	if err == sql.ErrNoRows || (deletedAt.Valid && deletedAt.Time.Before(params.DeletedSince)) {
+		return database.Chirp{}, ErrChirpNotFound
+	}
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	if chirp.UserID != params.UserID {
+		return database.Chirp{}, ErrChirpNotAuthor
+	}
+
+	if !params.IfVersions.Match(chirp.Version) {
+		return database.Chirp{}, ErrChirpVersionMismatch
+	}
+
+	if !deletedAt.Valid {
+		return database.Chirp{}, ErrChirpNotDeleted
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE chirps SET deleted_at = NULL, version = version + 1 WHERE id = ?", params.ID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	chirp.Version++
+
+	err = appendEvent(ctx, tx, database.NewChirpEvent(database.EventChirpRestored, chirp))
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return chirp, tx.Commit()
+}
+
+func (r *SQLiteChirpRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM chirps WHERE deleted_at < ?", deletedBefore.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (r *SQLiteChirpRepository) query(ctx context.Context, query string, args ...any) ([]database.Chirp, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chirps := []database.Chirp{}
+	for rows.Next() {
+		chirp := database.Chirp{}
+		err := rows.Scan(&chirp.ID, &chirp.Body, &chirp.UserID, hashtagsColumn{&chirp.Hashtags}, mentionsColumn{&chirp.Mentions}, &chirp.Version)
+		if err != nil {
+			return nil, err
+		}
+		chirps = append(chirps, chirp)
+	}
+	return chirps, rows.Err()
+}
+
+// hashtagsColumn scans chirps.hashtags, where the hashtags of a chirp are stored separated by spaces.
+type hashtagsColumn struct {
+	hashtags *[]string
+}
+
+func (c hashtagsColumn) Scan(value any) error {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into hashtags", value)
+	}
+	*c.hashtags = nil
+	if s != "" {
+		*c.hashtags = strings.Split(s, " ")
+	}
+	return nil
+}
+
+// mentionsColumn scans and stores chirps.mentions, where the mentions of a chirp are stored as a JSON array,
+// or an empty string when there are none.
+type mentionsColumn struct {
+	mentions *[]database.Mention
+}
+
+func (c mentionsColumn) Scan(value any) error {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into mentions", value)
+	}
+	*c.mentions = nil
+	if s == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s), c.mentions)
+}
+
+func (c mentionsColumn) Value() (driver.Value, error) {
+	if len(*c.mentions) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(*c.mentions)
+	return string(data), err
+}
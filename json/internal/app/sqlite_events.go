@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+type SQLiteEventRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteEventRepository(db *sql.DB) *SQLiteEventRepository {
+	return &SQLiteEventRepository{db: db}
+}
+
+// appendEvent stores event in tx, the transaction of the change it describes.
+// Transactions take the write lock when they begin, so events are numbered in the order they are committed.
+func appendEvent(ctx context.Context, tx *sql.Tx, event database.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO events (type, created_at, data) VALUES (?, ?, ?)",
+		event.Type,
+		event.Time,
+		data,
+	)
+	return err
+}
+
+func (r *SQLiteEventRepository) After(ctx context.Context, seq int64, limit int) ([]database.Event, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT seq, data FROM events WHERE seq > ? ORDER BY seq LIMIT ?", seq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []database.Event{}
+	for rows.Next() {
+		var seq int64
+		var data []byte
+		err := rows.Scan(&seq, &data)
+		if err != nil {
+			return nil, err
+		}
+
+		event := database.Event{}
+		err = json.Unmarshal(data, &event)
+		if err != nil {
+			return nil, err
+		}
+		event.Seq = seq
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *SQLiteEventRepository) LastSeq(ctx context.Context) (int64, error) {
+	// sqlite_sequence holds the largest seq ever used by the events table, even once it is deleted.
+	var seq int64
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'events'), 0)",
+	).Scan(&seq)
+	return seq, err
+}
+
+func (r *SQLiteEventRepository) Cursor(ctx context.Context, consumer string) (int64, error) {
+	var seq int64
+	err := r.db.QueryRowContext(ctx, "SELECT seq FROM event_cursors WHERE consumer = ?", consumer).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+func (r *SQLiteEventRepository) SetCursor(ctx context.Context, consumer string, seq int64) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO event_cursors (consumer, seq) VALUES (?, ?) ON CONFLICT (consumer) DO UPDATE SET seq = excluded.seq",
+		consumer,
+		seq,
+	)
+	return err
+}
+
+func (r *SQLiteEventRepository) Trim(ctx context.Context, before time.Time, maxSeq int64) (int, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM events WHERE created_at < ? AND seq <= ?", before.UTC(), maxSeq)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
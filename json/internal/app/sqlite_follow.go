@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+type SQLiteFollowRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteFollowRepository(db *sql.DB) *SQLiteFollowRepository {
+	return &SQLiteFollowRepository{db: db}
+}
+
+func (r *SQLiteFollowRepository) Follow(ctx context.Context, follow database.Follow) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var users int
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM users WHERE id IN (?, ?)",
+		follow.FollowerID,
+		follow.FolloweeID,
+	).Scan(&users)
+	if err != nil {
+		return err
+	}
+	if users != 2 {
+		return ErrUserNotFound
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		"INSERT OR IGNORE INTO follows (follower_id, followee_id) VALUES (?, ?)",
+		follow.FollowerID,
+		follow.FolloweeID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return err
+	}
+
+	err = appendEvent(ctx, tx, database.NewFollowEvent(database.EventUserFollowed, follow))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteFollowRepository) Unfollow(ctx context.Context, follow database.Follow) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM follows WHERE follower_id = ? AND followee_id = ?",
+		follow.FollowerID,
+		follow.FolloweeID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return err
+	}
+
+	err = appendEvent(ctx, tx, database.NewFollowEvent(database.EventUserUnfollowed, follow))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteFollowRepository) CountFollowers(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM follows WHERE followee_id = ?", userID).Scan(&n)
+	return n, err
+}
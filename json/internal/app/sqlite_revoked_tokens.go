@@ -0,0 +1,50 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+type SQLiteRevokedTokensRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRevokedTokensRepository(db *sql.DB) *SQLiteRevokedTokensRepository {
+	return &SQLiteRevokedTokensRepository{db: db}
+}
+
+func (r *SQLiteRevokedTokensRepository) Revoke(ctx context.Context, token string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO revoked_tokens (token) VALUES (?)", token)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return err
+	}
+
+	err = appendEvent(ctx, tx, database.NewTokenRevokedEvent(token))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteRevokedTokensRepository) IsRevoked(ctx context.Context, token string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE token = ?)",
+		token,
+	).Scan(&revoked)
+	return revoked, err
+}
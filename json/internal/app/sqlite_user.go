@@ -0,0 +1,263 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/id"
+)
+
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{db: db}
+}
+
+func (r *SQLiteUserRepository) Create(ctx context.Context, params database.CreateUserParams) (database.User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	user := database.User{
+		ID:       id.New(),
+		Email:    params.Email,
+		Password: params.Password,
+		Handle:   params.Handle,
+		Version:  1,
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO users (id, email, password, handle) VALUES (?, ?, ?, ?)",
+		user.ID,
+		user.Email,
+		user.Password,
+		user.Handle,
+	)
+	if err != nil {
+		return database.User{}, uniqueUserErr(err)
+	}
+
+	err = appendEvent(ctx, tx, database.NewUserEvent(database.EventUserCreated, user))
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, tx.Commit()
+}
+
+func (r *SQLiteUserRepository) GetByEmail(ctx context.Context, email string) (database.User, error) {
+	return getUser(ctx, r.db, "SELECT "+userColumns+" FROM users WHERE email = ?", email)
+}
+
+func (r *SQLiteUserRepository) GetByHandle(ctx context.Context, handle string) (database.User, error) {
+	// Users without a handle store it as the empty string.
+	if handle == "" {
+		return database.User{}, ErrUserNotFound
+	}
+
+	// The user who has the handle comes first, then the one who changed from it most recently.
+	return getUser(
+		ctx,
+		r.db,
+		"SELECT "+userColumns+` FROM users WHERE handle = ? OR previous_handle = ?
+		ORDER BY handle = ? DESC, handle_changed_at DESC, id DESC LIMIT 1`,
+		handle,
+		handle,
+		handle,
+	)
+}
+
+func (r *SQLiteUserRepository) GetByID(ctx context.Context, id string) (database.User, error) {
+	return getUserByID(ctx, r.db, id)
+}
+
+func (r *SQLiteUserRepository) GetAll(ctx context.Context) ([]database.User, error) {
+	return r.query(ctx, "SELECT "+userColumns+" FROM users")
+}
+
+func (r *SQLiteUserRepository) List(ctx context.Context, params database.ListUsersParams) ([]database.User, error) {
+	return r.query(ctx, "SELECT "+userColumns+" FROM users WHERE id > ? ORDER BY id LIMIT ?", params.After, params.Limit)
+}
+
+func (r *SQLiteUserRepository) query(ctx context.Context, query string, args ...any) ([]database.User, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []database.User{}
+	for rows.Next() {
+		user, err := scanUser(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *SQLiteUserRepository) Update(
+	ctx context.Context,
+	id string,
+	params database.UpdateUserParams,
+) (database.User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	old, err := getUserByID(ctx, tx, id)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	user, err := params.Apply(old, time.Now())
+	if err != nil {
+		return database.User{}, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE users SET email = ?, password = ?, handle = ?, previous_handle = ?, handle_changed_at = ?,
+		display_name = ?, bio = ?, location = ?, website = ?, version = ? WHERE id = ?`,
+		user.Email,
+		user.Password,
+		user.Handle,
+		user.PreviousHandle,
+		user.HandleChangedAt,
+		user.DisplayName,
+		user.Bio,
+		user.Location,
+		user.Website,
+		user.Version,
+		id,
+	)
+	if err != nil {
+		return database.User{}, uniqueUserErr(err)
+	}
+
+	return updatedUser(ctx, tx, id, database.EventUserUpdated)
+}
+
+func (r *SQLiteUserRepository) UpgradeToRed(ctx context.Context, id string) (database.User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE users SET is_chirpy_red = TRUE, version = version + 1 WHERE id = ?", id)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	err = expectOneRow(result, ErrUserNotFound)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return updatedUser(ctx, tx, id, database.EventUserUpgradedToRed)
+}
+
+// updatedUser reads the user a change in tx has just updated, stores the event of type t about it and commits tx.
+func updatedUser(ctx context.Context, tx *sql.Tx, id string, t database.EventType) (database.User, error) {
+	user, err := getUserByID(ctx, tx, id)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	err = appendEvent(ctx, tx, database.NewUserEvent(t, user))
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, tx.Commit()
+}
+
+// rowQuerier is implemented by both *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func getUserByID(ctx context.Context, q rowQuerier, id string) (database.User, error) {
+	return getUser(ctx, q, "SELECT "+userColumns+" FROM users WHERE id = ?", id)
+}
+
+func getUser(ctx context.Context, q rowQuerier, query string, args ...any) (database.User, error) {
+	user, err := scanUser(q.QueryRowContext(ctx, query, args...).Scan)
+	if err == sql.ErrNoRows {
+		return database.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, nil
+}
+
+// userColumns are the columns scanUser reads, in order.
+const userColumns = `id, email, password, is_chirpy_red, handle, previous_handle, handle_changed_at,
+	display_name, bio, location, website, version`
+
+// scanUser reads the userColumns of a row with scan.
+func scanUser(scan func(dest ...any) error) (database.User, error) {
+	user := database.User{}
+	var handleChangedAt sql.NullTime
+	err := scan(
+		&user.ID,
+		&user.Email,
+		&user.Password,
+		&user.IsChirpyRed,
+		&user.Handle,
+		&user.PreviousHandle,
+		&handleChangedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Location,
+		&user.Website,
+		&user.Version,
+	)
+	if handleChangedAt.Valid {
+		changedAt := handleChangedAt.Time.UTC()
+		user.HandleChangedAt = &changedAt
+	}
+	return user, err
+}
+
+// uniqueUserErr maps the violation of a UNIQUE constraint of users to the error of the column that caused it.
+func uniqueUserErr(err error) error {
+	switch {
+	case !isUniqueViolation(err):
+		return err
+	case strings.Contains(err.Error(), "users.handle"):
+		return ErrUserHandleTaken
+	default:
+		return ErrUserEmailTaken
+	}
+}
+
+// isUniqueViolation reports whether err was caused by a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	sqliteErr := sqlite3.Error{}
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// expectOneRow returns notFound if the statement that produced result did not affect any row.
+func expectOneRow(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+// Timeouts bound how long a single repository operation may take. A zero timeout does not bound it.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+// withTimeout returns ctx bounded by timeout, or ctx itself if timeout is zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutChirpRepository bounds every operation of a ChirpRepository with its read or write timeout.
+type timeoutChirpRepository struct {
+	next     database.ChirpRepository
+	timeouts Timeouts
+}
+
+func (r timeoutChirpRepository) Create(ctx context.Context, params database.CreateChirpParams) (database.Chirp, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.Create(ctx, params)
+}
+
+func (r timeoutChirpRepository) GetByID(ctx context.Context, id string) (database.Chirp, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.GetByID(ctx, id)
+}
+
+func (r timeoutChirpRepository) GetAll(ctx context.Context) ([]database.Chirp, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.GetAll(ctx)
+}
+
+func (r timeoutChirpRepository) GetByUserID(ctx context.Context, userID string) ([]database.Chirp, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.GetByUserID(ctx, userID)
+}
+
+func (r timeoutChirpRepository) List(ctx context.Context, params database.ListChirpsParams) ([]database.Chirp, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.List(ctx, params)
+}
+
+func (r timeoutChirpRepository) Delete(ctx context.Context, params database.DeleteChirpParams) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.Delete(ctx, params)
+}
+
+func (r timeoutChirpRepository) Restore(
+	ctx context.Context,
+	params database.RestoreChirpParams,
+) (database.Chirp, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.Restore(ctx, params)
+}
+
+func (r timeoutChirpRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.Purge(ctx, deletedBefore)
+}
+
+// timeoutUserRepository bounds every operation of a UserRepository with its read or write timeout.
+type timeoutUserRepository struct {
+	next     database.UserRepository
+	timeouts Timeouts
+}
+
+func (r timeoutUserRepository) Create(ctx context.Context, params database.CreateUserParams) (database.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.Create(ctx, params)
+}
+
+func (r timeoutUserRepository) GetByEmail(ctx context.Context, email string) (database.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.GetByEmail(ctx, email)
+}
+
+func (r timeoutUserRepository) GetByHandle(ctx context.Context, handle string) (database.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.GetByHandle(ctx, handle)
+}
+
+func (r timeoutUserRepository) GetByID(ctx context.Context, id string) (database.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.GetByID(ctx, id)
+}
+
+func (r timeoutUserRepository) GetAll(ctx context.Context) ([]database.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.GetAll(ctx)
+}
+
+func (r timeoutUserRepository) List(ctx context.Context, params database.ListUsersParams) ([]database.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.List(ctx, params)
+}
+
+func (r timeoutUserRepository) Update(
+	ctx context.Context,
+	id string,
+	params database.UpdateUserParams,
+) (database.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.Update(ctx, id, params)
+}
+
+func (r timeoutUserRepository) UpgradeToRed(ctx context.Context, id string) (database.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.UpgradeToRed(ctx, id)
+}
+
+// timeoutRevokedTokensRepository bounds every operation of a RevokedTokensRepository with its read or write timeout.
+type timeoutRevokedTokensRepository struct {
+	next     database.RevokedTokensRepository
+	timeouts Timeouts
+}
+
+func (r timeoutRevokedTokensRepository) Revoke(ctx context.Context, token string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.Revoke(ctx, token)
+}
+
+func (r timeoutRevokedTokensRepository) IsRevoked(ctx context.Context, token string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.IsRevoked(ctx, token)
+}
+
+// timeoutEventRepository bounds every operation of an EventRepository with its read or write timeout.
+type timeoutEventRepository struct {
+	next     database.EventRepository
+	timeouts Timeouts
+}
+
+func (r timeoutEventRepository) After(ctx context.Context, seq int64, limit int) ([]database.Event, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.After(ctx, seq, limit)
+}
+
+func (r timeoutEventRepository) LastSeq(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.LastSeq(ctx)
+}
+
+func (r timeoutEventRepository) Cursor(ctx context.Context, consumer string) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.Cursor(ctx, consumer)
+}
+
+func (r timeoutEventRepository) SetCursor(ctx context.Context, consumer string, seq int64) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.SetCursor(ctx, consumer, seq)
+}
+
+func (r timeoutEventRepository) Trim(ctx context.Context, before time.Time, maxSeq int64) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.Trim(ctx, before, maxSeq)
+}
+
+// timeoutFollowRepository bounds every operation of a FollowRepository with its read or write timeout.
+type timeoutFollowRepository struct {
+	next     database.FollowRepository
+	timeouts Timeouts
+}
+
+func (r timeoutFollowRepository) Follow(ctx context.Context, follow database.Follow) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.Follow(ctx, follow)
+}
+
+func (r timeoutFollowRepository) Unfollow(ctx context.Context, follow database.Follow) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	return r.next.Unfollow(ctx, follow)
+}
+
+func (r timeoutFollowRepository) CountFollowers(ctx context.Context, userID string) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.next.CountFollowers(ctx, userID)
+}
+
+// withTimeouts bounds every operation of the repositories of app with timeouts.
+func (app *App) withTimeouts(timeouts Timeouts) {
+	if timeouts == (Timeouts{}) {
+		return
+	}
+
+	app.ChirpRepository = timeoutChirpRepository{next: app.ChirpRepository, timeouts: timeouts}
+	app.UserRepository = timeoutUserRepository{next: app.UserRepository, timeouts: timeouts}
+	app.RevokedTokensRepository = timeoutRevokedTokensRepository{next: app.RevokedTokensRepository, timeouts: timeouts}
+	app.EventRepository = timeoutEventRepository{next: app.EventRepository, timeouts: timeouts}
+	app.FollowRepository = timeoutFollowRepository{next: app.FollowRepository, timeouts: timeouts}
+}
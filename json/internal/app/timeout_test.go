@@ -0,0 +1,42 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+// blockingChirpRepository blocks every operation until its context is done.
+type blockingChirpRepository struct {
+	database.ChirpRepository
+}
+
+func (blockingChirpRepository) GetAll(ctx context.Context) ([]database.Chirp, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingChirpRepository) Delete(ctx context.Context, params database.DeleteChirpParams) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestTimeouts(t *testing.T) {
+	repo := timeoutChirpRepository{
+		next:     blockingChirpRepository{},
+		timeouts: Timeouts{Read: time.Millisecond, Write: time.Millisecond},
+	}
+
+	_, err := repo.GetAll(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got: %v\nwant: %s", err, context.DeadlineExceeded)
+	}
+
+	err = repo.Delete(context.Background(), database.DeleteChirpParams{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got: %v\nwant: %s", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/id"
+)
+
+const (
+	// trendingInterval is how often the trending hashtags are computed again.
+	trendingInterval = time.Minute
+	// trendingWindow is how far back chirps count towards the trending hashtags.
+	trendingWindow = 24 * time.Hour
+	// trendingHalfLife is how long it takes for a use of a hashtag to count half as much.
+	trendingHalfLife = 4 * time.Hour
+	// trendingBatchSize is the number of chirps read at once while computing the trending hashtags.
+	trendingBatchSize = 500
+)
+
+// A TrendingHashtag is a hashtag and how much it was used within the trending window.
+type TrendingHashtag struct {
+	Tag string `json:"tag"`
+	// Score is the number of uses, each weighted by how recent it is: a use counts half as much every trendingHalfLife.
+	Score float64 `json:"score"`
+	Uses  int     `json:"uses"`
+}
+
+// ComputeTrendingHashtags computes the trending hashtags once right away then every trendingInterval,
+// until ctx is done. TrendingHashtags serves the result of the last computation.
+func (app *App) ComputeTrendingHashtags(ctx context.Context) {
+	ticker := time.NewTicker(trendingInterval)
+	defer ticker.Stop()
+
+	for {
+		err := app.updateTrendingHashtags(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("failed to compute trending hashtags : %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateTrendingHashtags ranks the hashtags of the chirps created within trendingWindow before now.
+func (app *App) updateTrendingHashtags(ctx context.Context, now time.Time) error {
+	chirps, err := app.chirpsSince(ctx, now.Add(-trendingWindow))
+	if err != nil {
+		return err
+	}
+
+	trending := rankHashtags(chirps, now)
+	app.trendingMu.Lock()
+	defer app.trendingMu.Unlock()
+	app.trending = trending
+	return nil
+}
+
+// chirpsSince returns the chirps created since since, the newest first.
+func (app *App) chirpsSince(ctx context.Context, since time.Time) ([]database.Chirp, error) {
+	chirps := []database.Chirp{}
+	params := database.ListChirpsParams{Desc: true, Limit: trendingBatchSize}
+	for {
+		batch, err := app.ChirpRepository.List(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, chirp := range batch {
+			if id.Time(chirp.ID).Before(since) {
+				return chirps, nil
+			}
+			chirps = append(chirps, chirp)
+		}
+		if len(batch) < trendingBatchSize {
+			return chirps, nil
+		}
+		params.After = batch[len(batch)-1].ID
+	}
+}
+
+// rankHashtags returns the hashtags of chirps, the highest score first, and in alphabetical order among equal scores.
+func rankHashtags(chirps []database.Chirp, now time.Time) []TrendingHashtag {
+	byTag := map[string]*TrendingHashtag{}
+	for _, chirp := range chirps {
+		age := max(now.Sub(id.Time(chirp.ID)), 0)
+		weight := math.Exp2(-float64(age) / float64(trendingHalfLife))
+
+		for _, tag := range chirp.Hashtags {
+			hashtag, ok := byTag[tag]
+			if !ok {
+				hashtag = &TrendingHashtag{Tag: tag}
+				byTag[tag] = hashtag
+			}
+			hashtag.Score += weight
+			hashtag.Uses++
+		}
+	}
+
+	trending := make([]TrendingHashtag, 0, len(byTag))
+	for _, hashtag := range byTag {
+		trending = append(trending, *hashtag)
+	}
+	slices.SortFunc(trending, func(a, b TrendingHashtag) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Tag, b.Tag)
+	})
+	return trending
+}
+
+// TrendingHashtags responds with the trending hashtags, as of their last computation.
+// The number of hashtags is bounded by the limit query parameter.
+func (app *App) TrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	app.trendingMu.RLock()
+	trending := app.trending[:min(limit, len(app.trending))]
+	app.trendingMu.RUnlock()
+
+	if trending == nil {
+		trending = []TrendingHashtag{}
+	}
+	respondWithJSON(w, http.StatusOK, trending)
+}
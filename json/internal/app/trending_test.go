@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+func TestRankHashtags(t *testing.T) {
+	// IDs hold the creation time to the millisecond.
+	now := time.Now().Truncate(time.Millisecond)
+	createdAgo := func(age time.Duration) string {
+		return ulid.MustNew(ulid.Timestamp(now.Add(-age)), nil).String()
+	}
+
+	chirps := []database.Chirp{
+		{ID: createdAgo(0), Hashtags: []string{"go", "new"}},
+		{ID: createdAgo(trendingHalfLife), Hashtags: []string{"old"}},
+		{ID: createdAgo(trendingHalfLife), Hashtags: []string{"old", "go"}},
+		{ID: createdAgo(2 * trendingHalfLife), Hashtags: []string{"older"}},
+	}
+	want := []TrendingHashtag{
+		{Tag: "go", Score: 1.5, Uses: 2},
+		{Tag: "new", Score: 1, Uses: 1},
+		{Tag: "old", Score: 1, Uses: 2},
+		{Tag: "older", Score: 0.25, Uses: 1},
+	}
+
+	got := rankHashtags(chirps, now)
+	if !slices.EqualFunc(got, want, func(a, b TrendingHashtag) bool {
+		return a.Tag == b.Tag && a.Uses == b.Uses && b.Score-a.Score < 1e-9 && a.Score-b.Score < 1e-9
+	}) {
+		t.Errorf("got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestHashtags(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t)
+	user := database.User{ID: "1"}
+
+	createChirp := func(body string) database.Chirp {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		app.CreateChirp(w, httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body": "`+body+`"}`)), user)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusCreated, w.Body)
+		}
+
+		chirp := database.Chirp{}
+		assertNoError(t, json.NewDecoder(w.Body).Decode(&chirp))
+		return chirp
+	}
+
+	first := createChirp("Learning #Go today #go")
+	createChirp("Nothing to see")
+	second := createChirp("#golang and #GO")
+	if !slices.Equal(first.Hashtags, []string{"go"}) || !slices.Equal(second.Hashtags, []string{"golang", "go"}) {
+		t.Errorf("got hashtags %v and %v", first.Hashtags, second.Hashtags)
+	}
+
+	t.Run("timeline", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/hashtags/%23Go/chirps?sort=desc", nil)
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("tag", "#Go")
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx))
+
+		w := httptest.NewRecorder()
+		app.GetChirpsByHashtag(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		page := struct {
+			Chirps []database.Chirp `json:"chirps"`
+		}{}
+		assertNoError(t, json.NewDecoder(w.Body).Decode(&page))
+		if got, want := chirpIDs(page.Chirps), []string{second.ID, first.ID}; !slices.Equal(got, want) {
+			t.Errorf("got: %v\nwant: %v", got, want)
+		}
+	})
+
+	t.Run("trending", func(t *testing.T) {
+		trending := func() []TrendingHashtag {
+			t.Helper()
+
+			w := httptest.NewRecorder()
+			app.TrendingHashtags(w, httptest.NewRequest(http.MethodGet, "/api/hashtags/trending", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d : %s", w.Code, http.StatusOK, w.Body)
+			}
+
+			hashtags := []TrendingHashtag{}
+			assertNoError(t, json.NewDecoder(w.Body).Decode(&hashtags))
+			return hashtags
+		}
+
+		if got := trending(); len(got) != 0 {
+			t.Errorf("got %v before the first computation, want none", got)
+		}
+
+		assertNoError(t, app.updateTrendingHashtags(ctx, time.Now()))
+		got := trending()
+		if len(got) != 2 || got[0].Tag != "go" || got[0].Uses != 2 || got[1].Tag != "golang" {
+			t.Errorf("got %v, want go used twice then golang", got)
+		}
+
+		// Outside of the window, nothing trends.
+		assertNoError(t, app.updateTrendingHashtags(ctx, time.Now().Add(trendingWindow+time.Minute)))
+		if got := trending(); len(got) != 0 {
+			t.Errorf("got %v, want none", got)
+		}
+	})
+}
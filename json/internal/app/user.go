@@ -1,23 +1,34 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/handle"
+	"github.com/zoumas/chirpy/json/internal/id"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type UserErr string
+type UserErr = database.UserErr
 
-func (e UserErr) Error() string {
-	return string(e)
-}
+var (
+	ErrEmailEmpty    = errors.New("email must not be empty")
+	ErrPasswordEmpty = errors.New("password must not be empty")
+)
 
 const (
-	ErrUserNotFound   = UserErr("User not found")
-	ErrUserEmailTaken = UserErr("Email taken")
+	ErrUserNotFound              = database.ErrUserNotFound
+	ErrUserEmailTaken            = database.ErrUserEmailTaken
+	ErrUserHandleTaken           = database.ErrUserHandleTaken
+	ErrUserVersionMismatch       = database.ErrUserVersionMismatch
+	ErrUserHandleChangedRecently = database.ErrUserHandleChangedRecently
 )
 
 type JSONUserRepository struct {
@@ -28,80 +39,140 @@ func NewJSONUserRepository(db *database.DB) *JSONUserRepository {
 	return &JSONUserRepository{db: db}
 }
 
-func (r *JSONUserRepository) Create(params database.CreateUserParams) (database.User, error) {
-	dbs, err := r.db.Load()
+func (r *JSONUserRepository) Create(ctx context.Context, params database.CreateUserParams) (database.User, error) {
+	user := database.User{}
+	err := r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		if _, ok := dbs.UserByEmail(params.Email); ok {
+			return ErrUserEmailTaken
+		}
+		if _, ok := dbs.UserByHandle(params.Handle); ok {
+			return ErrUserHandleTaken
+		}
+
+		user = database.User{
+			ID:       id.New(),
+			Email:    params.Email,
+			Password: params.Password,
+			Handle:   params.Handle,
+			Version:  1,
+		}
+		dbs.PutUser(user)
+		dbs.AppendEvent(database.NewUserEvent(database.EventUserCreated, user))
+		return nil
+	})
 	if err != nil {
 		return database.User{}, err
 	}
+	return user, nil
+}
 
-	// TODO: check if email is taken
-	if _, err := r.GetByEmail(params.Email); err == nil {
-		return database.User{}, ErrUserEmailTaken
-	}
-
-	id := len(dbs.Users) + 1
-	user := database.User{
-		ID:       id,
-		Email:    params.Email,
-		Password: params.Password,
-	}
-	dbs.Users[id] = user
-
-	err = r.db.Persist(dbs)
+func (r *JSONUserRepository) GetByEmail(ctx context.Context, email string) (database.User, error) {
+	user := database.User{}
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		var ok bool
+		user, ok = dbs.UserByEmail(email)
+		if !ok {
+			return ErrUserNotFound
+		}
+		return nil
+	})
 	if err != nil {
 		return database.User{}, err
 	}
 	return user, nil
 }
 
-func (r *JSONUserRepository) GetByEmail(email string) (database.User, error) {
-	dbs, err := r.db.Load()
+func (r *JSONUserRepository) GetByHandle(ctx context.Context, handle string) (database.User, error) {
+	user := database.User{}
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		var ok bool
+		user, ok = dbs.UserByHandle(handle)
+		if !ok {
+			user, ok = dbs.UserByPreviousHandle(handle)
+		}
+		if !ok {
+			return ErrUserNotFound
+		}
+		return nil
+	})
 	if err != nil {
 		return database.User{}, err
 	}
+	return user, nil
+}
 
-	for _, user := range dbs.Users {
-		if user.Email == email {
-			return user, nil
+func (r *JSONUserRepository) GetByID(ctx context.Context, id string) (database.User, error) {
+	user := database.User{}
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		var ok bool
+		user, ok = dbs.Users[id]
+		if !ok {
+			return ErrUserNotFound
 		}
+		return nil
+	})
+	if err != nil {
+		return database.User{}, err
 	}
-
-	return database.User{}, ErrUserNotFound
+	return user, nil
 }
 
-func (r *JSONUserRepository) GetByID(id int) (database.User, error) {
-	dbs, err := r.db.Load()
+func (r *JSONUserRepository) GetAll(ctx context.Context) ([]database.User, error) {
+	var users []database.User
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		users = make([]database.User, 0, len(dbs.Users))
+		for _, user := range dbs.Users {
+			users = append(users, user)
+		}
+		return nil
+	})
 	if err != nil {
-		return database.User{}, err
+		return nil, err
 	}
+	return users, nil
+}
 
-	user, ok := dbs.Users[id]
-	if !ok {
-		return database.User{}, ErrUserNotFound
+func (r *JSONUserRepository) List(ctx context.Context, params database.ListUsersParams) ([]database.User, error) {
+	var users []database.User
+	err := r.db.View(ctx, func(dbs *database.DBStructure) error {
+		users = dbs.ListUsers(params)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return user, nil
+	return users, nil
 }
 
 func (r *JSONUserRepository) Update(
-	id int,
+	ctx context.Context,
+	id string,
 	params database.UpdateUserParams,
 ) (database.User, error) {
-	dbs, err := r.db.Load()
-	if err != nil {
-		return database.User{}, err
-	}
-
-	user, ok := dbs.Users[id]
-	if !ok {
-		return database.User{}, ErrUserNotFound
-	}
+	user := database.User{}
+	err := r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		old, ok := dbs.Users[id]
+		if !ok {
+			return ErrUserNotFound
+		}
 
-	user.Email = params.Email
-	user.Password = params.Password
+		var err error
+		user, err = params.Apply(old, time.Now())
+		if err != nil {
+			return err
+		}
 
-	dbs.Users[user.ID] = user
+		if owner, ok := dbs.UserByEmail(user.Email); ok && owner.ID != id {
+			return ErrUserEmailTaken
+		}
+		if owner, ok := dbs.UserByHandle(user.Handle); ok && owner.ID != id {
+			return ErrUserHandleTaken
+		}
 
-	err = r.db.Persist(dbs)
+		dbs.PutUser(user)
+		dbs.AppendEvent(database.NewUserEvent(database.EventUserUpdated, user))
+		return nil
+	})
 	if err != nil {
 		return database.User{}, err
 	}
@@ -109,22 +180,22 @@ func (r *JSONUserRepository) Update(
 	return user, nil
 }
 
-func (r *JSONUserRepository) UpgradeToRed(id int) (database.User, error) {
-	dbs, err := r.db.Load()
-	if err != nil {
-		return database.User{}, err
-	}
-
-	user, ok := dbs.Users[id]
-	if !ok {
-		return database.User{}, ErrUserNotFound
-	}
-
-	user.IsChirpyRed = true
+func (r *JSONUserRepository) UpgradeToRed(ctx context.Context, id string) (database.User, error) {
+	user := database.User{}
+	err := r.db.Update(ctx, func(dbs *database.DBStructure) error {
+		var ok bool
+		user, ok = dbs.Users[id]
+		if !ok {
+			return ErrUserNotFound
+		}
 
-	dbs.Users[user.ID] = user
+		user.IsChirpyRed = true
+		user.Version++
 
-	err = r.db.Persist(dbs)
+		dbs.PutUser(user)
+		dbs.AppendEvent(database.NewUserEvent(database.EventUserUpgradedToRed, user))
+		return nil
+	})
 	if err != nil {
 		return database.User{}, err
 	}
@@ -136,6 +207,8 @@ func (app *App) CreateUser(w http.ResponseWriter, r *http.Request) {
 	type RequestBody struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// Handle is optional: users can pick one later.
+		Handle string `json:"handle"`
 	}
 	body := RequestBody{}
 
@@ -146,30 +219,46 @@ func (app *App) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	body.Handle = handle.Normalize(body.Handle)
+	if body.Handle != "" {
+		err := handle.Validate(body.Handle)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	user, err := app.UserRepository.Create(database.CreateUserParams{
-		Email:    body.Email,
+	user, err := app.UserRepository.Create(r.Context(), database.CreateUserParams{
+		Email:    app.normalizeEmail(body.Email),
 		Password: string(hashedPassword),
+		Handle:   body.Handle,
 	})
+	if err == ErrUserEmailTaken || err == ErrUserHandleTaken {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	type ResponseBody struct {
-		ID          int    `json:"id"`
+		ID          string `json:"id"`
 		Email       string `json:"email"`
+		Handle      string `json:"handle,omitempty"`
 		IsChirpyRed bool   `json:"is_chirpy_red"`
 	}
+	w.Header().Set("ETag", etag(user.Version))
 	respondWithJSON(
 		w,
 		http.StatusCreated,
-		ResponseBody{ID: user.ID, Email: user.Email, IsChirpyRed: user.IsChirpyRed},
+		ResponseBody{ID: user.ID, Email: user.Email, Handle: user.Handle, IsChirpyRed: user.IsChirpyRed},
 	)
 }
 
@@ -187,7 +276,7 @@ func (app *App) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := app.UserRepository.GetByEmail(body.Email)
+	user, err := app.UserRepository.GetByEmail(r.Context(), app.normalizeEmail(body.Email))
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, err.Error())
 		return
@@ -222,18 +311,21 @@ func (app *App) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type ResponseBody struct {
-		ID           int    `json:"id"`
+		ID           string `json:"id"`
 		Email        string `json:"email"`
+		Handle       string `json:"handle,omitempty"`
 		IsChirpyRed  bool   `json:"is_chirpy_red"`
 		Token        string `json:"token"`
 		RefreshToken string `json:"refresh_token"`
 	}
+	w.Header().Set("ETag", etag(user.Version))
 	respondWithJSON(
 		w,
 		http.StatusOK,
 		ResponseBody{
 			ID:           user.ID,
 			Email:        user.Email,
+			Handle:       user.Handle,
 			IsChirpyRed:  user.IsChirpyRed,
 			Token:        signedAccessToken,
 			RefreshToken: signedRefreshToken,
@@ -241,10 +333,17 @@ func (app *App) Login(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+// UpdateUser changes the fields of the user present in the request body, leaving the others unchanged.
+// The handle can change at most once every Env.HandleChangeInterval.
 func (app *App) UpdateUser(w http.ResponseWriter, r *http.Request, user database.User) {
 	type RequestBody struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email       *string `json:"email"`
+		Password    *string `json:"password"`
+		Handle      *string `json:"handle"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		Location    *string `json:"location"`
+		Website     *string `json:"website"`
 	}
 	body := RequestBody{}
 
@@ -254,37 +353,98 @@ func (app *App) UpdateUser(w http.ResponseWriter, r *http.Request, user database
 		return
 	}
 
-	if body.Email != user.Email {
-		_, err := app.UserRepository.GetByEmail(body.Email)
-		if err == ErrUserEmailTaken {
-			respondWithError(w, http.StatusBadRequest, ErrUserEmailTaken.Error())
-			return
-		}
+	if body.Handle != nil {
+		normalized := handle.Normalize(*body.Handle)
+		body.Handle = &normalized
 	}
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	err = errors.Join(
+		validateHandle(body.Handle),
+		validateProfileField("display_name", body.DisplayName, maxDisplayNameLength),
+		validateProfileField("bio", body.Bio, maxBioLength),
+		validateProfileField("location", body.Location, maxLocationLength),
+		validateWebsite(body.Website),
+	)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	updatedUser, err := app.UserRepository.Update(user.ID, database.UpdateUserParams{
-		Email:    body.Email,
-		Password: string(hashedPassword),
+	if body.Email != nil {
+		email := app.normalizeEmail(*body.Email)
+		if email == "" {
+			respondWithError(w, http.StatusBadRequest, ErrEmailEmpty.Error())
+			return
+		}
+		if email != user.Email {
+			owner, err := app.UserRepository.GetByEmail(r.Context(), email)
+			if err == nil && owner.ID != user.ID {
+				respondWithError(w, http.StatusBadRequest, ErrUserEmailTaken.Error())
+				return
+			}
+		}
+		body.Email = &email
+	}
+
+	if body.Password != nil {
+		if *body.Password == "" {
+			respondWithError(w, http.StatusBadRequest, ErrPasswordEmpty.Error())
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*body.Password), bcrypt.DefaultCost)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		hash := string(hashedPassword)
+		body.Password = &hash
+	}
+
+	updatedUser, err := app.UserRepository.Update(r.Context(), user.ID, database.UpdateUserParams{
+		Email:                body.Email,
+		Password:             body.Password,
+		Handle:               body.Handle,
+		DisplayName:          body.DisplayName,
+		Bio:                  body.Bio,
+		Location:             body.Location,
+		Website:              body.Website,
+		HandleUnchangedSince: time.Now().Add(-app.Env.HandleChangeInterval),
+		IfVersions:           ifMatchVersions(r),
 	})
+	if err == ErrUserEmailTaken || err == ErrUserHandleTaken {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err == ErrUserHandleChangedRecently {
+		if user.HandleChangedAt != nil {
+			retryAfter := time.Until(user.HandleChangedAt.Add(app.Env.HandleChangeInterval))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+		respondWithError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err == ErrUserVersionMismatch {
+		respondWithError(w, http.StatusPreconditionFailed, err.Error())
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	type ResponseBody struct {
-		ID          int    `json:"id"`
-		Email       string `json:"email"`
-		IsChirpyRed bool   `json:"is_chirpy_red"`
+		ID     string `json:"id"`
+		Email  string `json:"email"`
+		Handle string `json:"handle,omitempty"`
+		database.Profile
+		IsChirpyRed bool `json:"is_chirpy_red"`
 	}
+	w.Header().Set("ETag", etag(updatedUser.Version))
 	respondWithJSON(w, http.StatusOK, ResponseBody{
 		ID:          updatedUser.ID,
 		Email:       updatedUser.Email,
+		Handle:      updatedUser.Handle,
+		Profile:     updatedUser.Profile,
 		IsChirpyRed: updatedUser.IsChirpyRed,
 	})
 }
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// tempSuffix marks the temporary files written by writeFileAtomic.
+const tempSuffix = ".tmp-"
+
+// write writes data to f. It is a variable so that tests can inject failures halfway through a write.
+var write = func(f *os.File, data []byte) (int, error) {
+	return f.Write(data)
+}
+
+// writeFileAtomic replaces the file at path with data so that a crash at any point leaves
+// either the old or the new contents on disk, never a mix of the two.
+// The data is written to a temporary file in the same directory, fsynced and renamed over path,
+// then the directory is fsynced so that the rename itself is durable.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err := os.CreateTemp(dir, base+tempSuffix+"*")
+	if err != nil {
+		return err
+	}
+	tempPath := f.Name()
+
+	err = func() error {
+		defer f.Close()
+
+		_, err := write(f, data)
+		if err != nil {
+			return err
+		}
+
+		err = f.Chmod(perm)
+		if err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	err = os.Rename(tempPath, path)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// removeTempFiles deletes the temporary files left behind by an interrupted writeFileAtomic of path.
+func removeTempFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + tempSuffix + "*")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, match := range matches {
+		err := os.Remove(match)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
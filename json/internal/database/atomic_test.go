@@ -0,0 +1,50 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomicFailureHalfwayThrough(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	assertNoError(t, writeFileAtomic(path, []byte(`{"old": true}`), 0644))
+
+	errDiskFull := errors.New("no space left on device")
+	defer func(original func(*os.File, []byte) (int, error)) { write = original }(write)
+	write = func(f *os.File, data []byte) (int, error) {
+		n, _ := f.Write(data[:len(data)/2])
+		return n, errDiskFull
+	}
+
+	err := writeFileAtomic(path, []byte(`{"new": true, "padding": "................"}`), 0644)
+	if !errors.Is(err, errDiskFull) {
+		t.Fatalf("got: %v\nwant: %v", err, errDiskFull)
+	}
+
+	data, err := os.ReadFile(path)
+	assertNoError(t, err)
+	if string(data) != `{"old": true}` {
+		t.Errorf("database file was modified by a failed write: %q", data)
+	}
+
+	matches, _ := filepath.Glob(path + tempSuffix + "*")
+	if len(matches) != 0 {
+		t.Errorf("failed write left temporary files behind: %v", matches)
+	}
+}
+
+func TestNewRemovesLeftoverTempFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	leftover := path + tempSuffix + "123"
+	assertNoError(t, os.WriteFile(leftover, []byte(`{"chirps": {`), 0644))
+
+	_, err := New(path, Options{})
+	assertNoError(t, err)
+
+	_, err = os.Stat(leftover)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("leftover temporary file was not removed: %v", err)
+	}
+}
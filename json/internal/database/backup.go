@@ -0,0 +1,119 @@
+package database
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxSnapshotSize bounds the size of a decompressed snapshot, so that a small gzip stream cannot exhaust the memory.
+// It is a variable so that tests can lower it.
+var maxSnapshotSize int64 = 1 << 30
+
+// ErrInvalidSnapshot is returned when restoring a snapshot that cannot be decoded or is inconsistent.
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// ErrSnapshotTooLarge is returned when restoring a snapshot larger than 1 GiB once decompressed.
+var ErrSnapshotTooLarge = errors.New("snapshot is too large")
+
+// Backup writes a gzip-compressed JSON snapshot of the database to w.
+// The snapshot is never encrypted: it is meant to be stored by whoever downloads it.
+// The snapshot is taken under the lock, so it is consistent, but compressed and written after releasing it.
+func (db *DB) Backup(w io.Writer) error {
+	db.mu.RLock()
+	data, err := json.Marshal(db.state)
+	db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	_, err = gz.Write(data)
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Restore replaces the content of the database with the snapshot read from r, as written by Backup.
+// The snapshot is validated before anything is changed, then swapped in and written to disk atomically.
+func (db *DB) Restore(r io.Reader) error {
+	dbs, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+
+	// A flush in progress must not overwrite the restored file with the old state.
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	err = db.persist(dbs)
+	if err != nil {
+		return err
+	}
+	if db.wal != nil {
+		err = db.wal.truncate()
+		if err != nil {
+			return err
+		}
+		err = db.wal.removeRotated()
+		if err != nil {
+			return err
+		}
+	}
+
+	db.state = dbs
+	db.version++
+	db.flushed = db.version
+	return nil
+}
+
+// RestoreFile replaces the database file at path with the snapshot read from r, as written by Backup.
+// It is meant for a stopped server: the snapshot is validated, written atomically and the write-ahead log is discarded.
+// The file is encrypted with keys.
+func RestoreFile(path string, keys *Keyring, r io.Reader) error {
+	dbs, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+
+	db := &DB{path: path, keys: keys}
+	err = db.persist(dbs)
+	if err != nil {
+		return err
+	}
+	return removeWAL(path)
+}
+
+// readSnapshot decompresses, decodes and validates a snapshot. Snapshots of older versions are migrated.
+// Errors reading r are wrapped, so that callers can tell them apart.
+func readSnapshot(r io.Reader) (DBStructure, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return DBStructure{}, fmt.Errorf("%w : %w", ErrInvalidSnapshot, err)
+	}
+	defer gz.Close()
+
+	data, err := io.ReadAll(io.LimitReader(gz, maxSnapshotSize+1))
+	if err != nil {
+		return DBStructure{}, fmt.Errorf("%w : %w", ErrInvalidSnapshot, err)
+	}
+	if int64(len(data)) > maxSnapshotSize {
+		return DBStructure{}, fmt.Errorf("%w : more than %d bytes once decompressed", ErrSnapshotTooLarge, maxSnapshotSize)
+	}
+
+	dbs, _, err := decode(data)
+	if err != nil {
+		return DBStructure{}, fmt.Errorf("%w : %s", ErrInvalidSnapshot, err)
+	}
+
+	err = dbs.Validate()
+	if err != nil {
+		return DBStructure{}, fmt.Errorf("%w : %s", ErrInvalidSnapshot, err)
+	}
+	return dbs, nil
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "database.json"), Options{})
+	assertNoError(t, err)
+	putUsers(t, db, 2)
+
+	backup := &bytes.Buffer{}
+	assertNoError(t, db.Backup(backup))
+
+	putUsers(t, db, 5)
+	assertUsers(t, db, 5)
+
+	assertNoError(t, db.Restore(bytes.NewReader(backup.Bytes())))
+	assertUsers(t, db, 2)
+	db.View(context.Background(), func(dbs *DBStructure) error {
+		if _, ok := dbs.UserByEmail("user2@example.com"); !ok {
+			t.Error("indexes were not rebuilt after restoring")
+		}
+		return nil
+	})
+
+	// The restored state reached the disk.
+	reopened, err := New(db.path, Options{})
+	assertNoError(t, err)
+	assertUsers(t, reopened, 2)
+}
+
+func TestRestoreRejectsInvalidSnapshots(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "database.json"), Options{})
+	assertNoError(t, err)
+	putUsers(t, db, 1)
+
+	inconsistent := &bytes.Buffer{}
+	gz := gzip.NewWriter(inconsistent)
+	gz.Write([]byte(`{"version": 1, "users": {"a": {"id": "b"}}}`))
+	gz.Close()
+
+	snapshots := map[string][]byte{
+		"not gzip":     []byte(`{"users": {}}`),
+		"inconsistent": inconsistent.Bytes(),
+	}
+	for desc, snapshot := range snapshots {
+		t.Run(desc, func(t *testing.T) {
+			err := db.Restore(bytes.NewReader(snapshot))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			assertUsers(t, db, 1)
+		})
+	}
+}
+
+func TestRestoreRejectsLargeSnapshots(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "database.json"), Options{})
+	assertNoError(t, err)
+	putUsers(t, db, 1)
+
+	backup := &bytes.Buffer{}
+	assertNoError(t, db.Backup(backup))
+
+	limit := maxSnapshotSize
+	t.Cleanup(func() { maxSnapshotSize = limit })
+	maxSnapshotSize = 10
+
+	err = db.Restore(backup)
+	if !errors.Is(err, ErrSnapshotTooLarge) {
+		t.Fatalf("got: %v\nwant: %v", err, ErrSnapshotTooLarge)
+	}
+	assertUsers(t, db, 1)
+}
@@ -1,26 +1,101 @@
 package database
 
+import (
+	"context"
+	"time"
+)
+
+type ChirpErr string
+
+func (e ChirpErr) Error() string {
+	return string(e)
+}
+
+// Errors every ChirpRepository returns.
+const (
+	ErrChirpNotFound   = ChirpErr("Chirp not found")
+	ErrChirpNotAuthor  = ChirpErr("Chirp is not owned by this user")
+	ErrChirpNotDeleted = ChirpErr("Chirp is not deleted")
+	// ErrChirpVersionMismatch is returned when a chirp is no longer at the version a change expects.
+	ErrChirpVersionMismatch = ChirpErr("Chirp was modified")
+)
+
 // A Chirp is a text-only post, similar to twitter's Tweet.
+// Its ID sorts by creation time.
 type Chirp struct {
-	ID     int    `json:"id"`
+	ID     string `json:"id"`
 	Body   string `json:"body"`
-	UserID int    `json:"author_id"`
+	UserID string `json:"author_id"`
+	// Hashtags are the normalized tags of the body, as returned by hashtag.Parse.
+	Hashtags []string `json:"hashtags,omitempty"`
+	// Mentions are the @handles of the body that were resolved to users when the chirp was created, in order.
+	Mentions []Mention `json:"mentions,omitempty"`
+	// Version starts at 1 and is incremented by every change of the chirp.
+	Version int `json:"version"`
+	// DeletedAt is when the chirp was deleted. Deleted chirps are kept, and can be restored,
+	// until they are purged, but repositories never return them.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// A Mention is an @handle in the body of a chirp, resolved to the user who had the handle when the chirp was created.
+type Mention struct {
+	UserID string `json:"user_id"`
+	// Handle is the mentioned handle, normalized. The user may have changed it since.
+	Handle string `json:"handle"`
+	// Start and End are the byte offsets of the mention in the body, @ included: Body[Start:End].
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
 type CreateChirpParams struct {
-	Body   string
-	UserID int
+	Body     string
+	UserID   string
+	Hashtags []string
+	Mentions []Mention
 }
 
 type DeleteChirpParams struct {
-	ID     int
-	UserID int
+	ID     string
+	UserID string
+	// IfVersions, unless empty, are the versions the chirp must be at: any of them.
+	IfVersions Versions
+}
+
+type RestoreChirpParams struct {
+	ID     string
+	UserID string
+	// DeletedSince is the start of the window in which deleted chirps can be restored.
+	// Chirps deleted before it are treated as purged.
+	DeletedSince time.Time
+	// IfVersions, unless empty, are the versions the chirp must be at: any of them.
+	IfVersions Versions
+}
+
+// ListChirpsParams select a page of chirps, in ID order.
+type ListChirpsParams struct {
+	// AuthorID, unless empty, restricts the page to the chirps of a single user.
+	AuthorID string
+	// Hashtag, unless empty, restricts the page to the chirps tagged with it.
+	Hashtag string
+	// MentionedUserID, unless empty, restricts the page to the chirps that mention the user.
+	MentionedUserID string
+	// After, unless empty, is the ID of the last chirp of the previous page: the page starts right after it.
+	After string
+	// Desc lists the newest chirps first.
+	Desc  bool
+	Limit int
 }
 
 type ChirpRepository interface {
-	Create(params CreateChirpParams) (Chirp, error)
-	GetByID(id int) (Chirp, error)
-	GetAll() ([]Chirp, error)
-	GetByUserID(userID int) ([]Chirp, error)
-	Delete(params DeleteChirpParams) error
+	Create(ctx context.Context, params CreateChirpParams) (Chirp, error)
+	GetByID(ctx context.Context, id string) (Chirp, error)
+	GetAll(ctx context.Context) ([]Chirp, error)
+	GetByUserID(ctx context.Context, userID string) ([]Chirp, error)
+	// List returns a page of at most params.Limit chirps.
+	List(ctx context.Context, params ListChirpsParams) ([]Chirp, error)
+	// Delete marks a chirp as deleted.
+	Delete(ctx context.Context, params DeleteChirpParams) error
+	Restore(ctx context.Context, params RestoreChirpParams) (Chirp, error)
+	// Purge permanently removes the chirps deleted before deletedBefore and returns how many it removed.
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)
 }
@@ -4,78 +4,495 @@
 package database
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"sync"
+	"time"
 )
 
 // DB serves as a database using an underlying JSON file.
+//
+// The DBStructure is kept in memory and is the source of truth: reads never touch the disk.
+// By default changes are flushed to the file in the background every FlushInterval.
+// In write-ahead log mode every Update appends its mutations to a log instead,
+// and the log is periodically compacted into the file in the background.
 type DB struct {
+	// path is empty for a database that only lives in memory.
 	path string
 	mu   *sync.RWMutex
+
+	state DBStructure
+	// version counts the committed updates, flushed is the version last written to the file.
+	version uint64
+	flushed uint64
+	flushMu *sync.Mutex
+
+	flushInterval    time.Duration
+	wal              *wal
+	compactThreshold int
+	done             chan struct{}
+	stopped          chan struct{}
+
+	keys *Keyring
+	// stale is set when the loaded files are not encrypted with the primary key and must be rewritten.
+	stale bool
 }
 
+// DBStructure is the content of the database.
+// Changes must be made through its mutation methods (PutChirp, PutUser...) so that they can be logged.
 type DBStructure struct {
-	Chirps        map[int]Chirp       `json:"chirps"`
-	Users         map[int]User        `json:"users"`
+	Version       int                 `json:"version"`
+	Chirps        map[string]Chirp    `json:"chirps"`
+	Users         map[string]User     `json:"users"`
 	RevokedTokens map[string]struct{} `json:"revoked_tokens"`
+	// Follows maps the ID of a user to the IDs of the users they follow.
+	Follows map[string]map[string]struct{} `json:"follows"`
+	// Events are ordered by Seq. LastEventSeq is the Seq of the last event ever stored, even once it is trimmed.
+	Events       []Event          `json:"events"`
+	LastEventSeq int64            `json:"last_event_seq"`
+	EventCursors map[string]int64 `json:"event_cursors"`
+
+	indexes indexes
+
+	// changes and undo track the mutations made by the Update in progress.
+	changes []Mutation
+	undo    []func()
 }
 
 func NewDBStructure() DBStructure {
-	return DBStructure{
-		Chirps:        make(map[int]Chirp),
-		Users:         make(map[int]User),
+	dbs := DBStructure{
+		Version:       CurrentVersion,
+		Chirps:        make(map[string]Chirp),
+		Users:         make(map[string]User),
 		RevokedTokens: make(map[string]struct{}),
+		Follows:       make(map[string]map[string]struct{}),
+		Events:        []Event{},
+		EventCursors:  make(map[string]int64),
+	}
+	dbs.buildIndexes()
+	return dbs
+}
+
+// Validate checks that a DBStructure loaded from disk is consistent and builds its secondary indexes.
+// Missing collections are initialized so that older files remain usable.
+func (dbs *DBStructure) Validate() error {
+	if dbs.Chirps == nil {
+		dbs.Chirps = make(map[string]Chirp)
+	}
+	if dbs.Users == nil {
+		dbs.Users = make(map[string]User)
+	}
+	if dbs.RevokedTokens == nil {
+		dbs.RevokedTokens = make(map[string]struct{})
+	}
+	if dbs.Follows == nil {
+		dbs.Follows = make(map[string]map[string]struct{})
+	}
+	if dbs.Events == nil {
+		dbs.Events = []Event{}
+	}
+	if dbs.EventCursors == nil {
+		dbs.EventCursors = make(map[string]int64)
+	}
+
+	for id, chirp := range dbs.Chirps {
+		if chirp.ID != id {
+			return fmt.Errorf("chirp stored under id %q has id %q", id, chirp.ID)
+		}
+	}
+	owners := make(map[string]string, len(dbs.Users))
+	for id, user := range dbs.Users {
+		if user.ID != id {
+			return fmt.Errorf("user stored under id %q has id %q", id, user.ID)
+		}
+		if owner, taken := owners[user.Email]; taken {
+			return fmt.Errorf("users %q and %q have the same email", owner, id)
+		}
+		owners[user.Email] = id
+	}
+	for followerID, followeeIDs := range dbs.Follows {
+		for followeeID := range followeeIDs {
+			_, followerOK := dbs.Users[followerID]
+			_, followeeOK := dbs.Users[followeeID]
+			if !followerOK || !followeeOK {
+				return fmt.Errorf("follow of %q by %q references an unknown user", followeeID, followerID)
+			}
+		}
+	}
+	for i, event := range dbs.Events {
+		if event.Seq > dbs.LastEventSeq || (i > 0 && event.Seq <= dbs.Events[i-1].Seq) {
+			return fmt.Errorf("event %d is out of order", event.Seq)
+		}
 	}
+
+	dbs.buildIndexes()
+	return nil
+}
+
+// Options control how an existing database file is treated when it is opened.
+type Options struct {
+	// Reset truncates the database file, discarding all of its data.
+	Reset bool
+	// Recover moves a corrupt database file aside and starts with an empty database
+	// instead of refusing to open it.
+	Recover bool
+	// FlushInterval is how often changes are written to the file.
+	// Zero writes the file synchronously on every Update. It is ignored in write-ahead log mode.
+	FlushInterval time.Duration
+	// WAL enables write-ahead log mode.
+	WAL bool
+	// CompactThreshold is the number of logged transactions after which the log is compacted.
+	// It defaults to DefaultCompactThreshold.
+	CompactThreshold int
+	// Keys encrypt the database file and the log. They are written in plaintext when it is nil.
+	Keys *Keyring
 }
 
-// New creates a new database file on the filesystem or truncates it if it already exists.
-// This implementation always starts with an empty database.
-func New(path string) (*DB, error) {
-	_, err := os.Create(path)
+// fileMode is the permission of the database files: they hold password hashes and tokens.
+const fileMode os.FileMode = 0600
+
+// ErrCorrupt is returned by New when the database file cannot be parsed or is inconsistent.
+var ErrCorrupt = errors.New("database file is corrupt")
+
+// New opens the database file on the filesystem, creating it if it does not exist.
+// An existing file is loaded and validated; it is only truncated when options.Reset is set.
+// Temporary files left behind by a write that was interrupted by a crash are removed.
+// Files that are not encrypted with the primary key of options.Keys are rewritten with it.
+// A file encrypted with a key that is not configured fails with ErrWrongKey.
+// The returned DB must be closed to guarantee that every change reaches the disk.
+func New(path string, options Options) (*DB, error) {
+	db := &DB{
+		path:          path,
+		mu:            &sync.RWMutex{},
+		flushMu:       &sync.Mutex{},
+		flushInterval: options.FlushInterval,
+		keys:          options.Keys,
+	}
+
+	leftovers, err := removeTempFiles(path)
 	if err != nil {
 		return nil, err
 	}
+	for _, leftover := range leftovers {
+		log.Printf("removed leftover temporary database file %s", leftover)
+	}
 
-	db := &DB{
-		path: path,
-		mu:   &sync.RWMutex{},
+	err = db.open(options)
+	if err != nil {
+		return nil, err
 	}
 
-	err = db.Persist(NewDBStructure())
+	db.state, db.stale, err = db.load()
 	if err != nil {
 		return nil, err
 	}
+
+	if options.WAL {
+		if options.CompactThreshold <= 0 {
+			options.CompactThreshold = DefaultCompactThreshold
+		}
+		err = db.openWAL(options.CompactThreshold)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if db.stale {
+		err = db.rewrite()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if db.wal != nil || db.flushInterval > 0 {
+		db.done = make(chan struct{})
+		db.stopped = make(chan struct{})
+		go db.background()
+	}
 	return db, nil
 }
 
-// Load read the file from DB.path, unmarshalls it into JSON and returns a DBStructure
-func (db *DB) Load() (DBStructure, error) {
+// NewMemory returns a database that only lives in memory: nothing is ever written to disk
+// and its content is lost when it is closed.
+func NewMemory() *DB {
+	return &DB{
+		mu:      &sync.RWMutex{},
+		flushMu: &sync.Mutex{},
+		state:   NewDBStructure(),
+	}
+}
+
+// open makes sure that a valid database file exists at db.path.
+func (db *DB) open(options Options) error {
+	if options.Reset {
+		err := removeWAL(db.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := os.Stat(db.path)
+	switch {
+	case options.Reset || errors.Is(err, os.ErrNotExist):
+		return db.persist(NewDBStructure())
+	case err != nil:
+		return err
+	}
+
+	err = os.Chmod(db.path, fileMode)
+	if err != nil {
+		return err
+	}
+
+	err = db.validate()
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrCorrupt) {
+		return err
+	}
+	if !options.Recover {
+		return fmt.Errorf("%w (start with -recover to move it aside)", err)
+	}
+
+	suffix := fmt.Sprintf(".corrupt-%d", time.Now().Unix())
+	for _, path := range []string{db.path, db.path + walSuffix, db.path + walSuffix + rotatedSuffix} {
+		err = os.Rename(path, path+suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	log.Printf("moved corrupt database to %s, starting with an empty database", db.path+suffix)
+
+	return db.persist(NewDBStructure())
+}
+
+// validate checks that the database file and its write-ahead log, if any, can be loaded.
+func (db *DB) validate() error {
+	dbs, _, err := db.load()
+	if err != nil {
+		return err
+	}
+
+	_, _, err = replayWALs(db.path, &dbs, db.keys)
+	return err
+}
+
+// rewrite writes the whole state to the file, encrypted with the primary key, and empties the log.
+func (db *DB) rewrite() error {
+	err := db.persist(db.state)
+	if err != nil {
+		return err
+	}
+	if db.wal != nil {
+		err = db.wal.truncate()
+		if err != nil {
+			return err
+		}
+		err = db.wal.removeRotated()
+		if err != nil {
+			return err
+		}
+	}
+
+	db.stale = false
+	log.Printf("rewrote %s with the current encryption key", db.path)
+	return nil
+}
+
+// background flushes or compacts the database until Close is called.
+func (db *DB) background() {
+	defer close(db.stopped)
+
+	interval := db.flushInterval
+	if db.wal != nil {
+		interval = compactCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.done:
+			return
+		case <-ticker.C:
+			if db.wal != nil {
+				db.compactIfNeeded()
+				continue
+			}
+
+			err := db.Flush()
+			if err != nil {
+				log.Printf("failed to flush the database : %s", err)
+			}
+		}
+	}
+}
+
+// Flush writes the changes that have not reached the disk yet.
+// In write-ahead log mode every change is already on disk and Flush compacts the log instead.
+func (db *DB) Flush() error {
+	if db.wal != nil {
+		return db.Compact()
+	}
+	if db.path == "" {
+		return nil
+	}
+
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+
 	db.mu.RLock()
-	defer db.mu.RUnlock()
+	version := db.version
+	if version == db.flushed {
+		db.mu.RUnlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(db.state, "", "\t")
+	db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
 
-	data, err := os.ReadFile(db.path)
+	data, err = db.keys.seal(data)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(db.path, data, fileMode)
 	if err != nil {
-		return DBStructure{}, err
+		return err
+	}
+	db.flushed = version
+	return nil
+}
+
+// Close stops the background work and writes every remaining change to the disk.
+func (db *DB) Close() error {
+	if db.done != nil {
+		close(db.done)
+		<-db.stopped
+	}
+
+	err := db.Flush()
+	if err != nil {
+		return err
 	}
 
-	dbs := DBStructure{}
-	err = json.Unmarshal(data, &dbs)
+	if db.wal != nil {
+		return db.wal.close()
+	}
+	return nil
+}
+
+// View runs fn with the current state of the database under a read lock.
+// fn must not modify dbs. fn is not run if ctx is done by the time the lock is acquired.
+func (db *DB) View(ctx context.Context, fn func(dbs *DBStructure) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	err := ctx.Err()
 	if err != nil {
-		return DBStructure{}, err
+		return err
 	}
-	return dbs, nil
+	return fn(&db.state)
 }
 
-// Persist writes the JSON encoding of a given DBStructure to the file from DB.path
-func (db *DB) Persist(dbs DBStructure) error {
+// Update runs fn with the current state of the database under the write lock,
+// so concurrent updates never overwrite each other.
+// If fn returns an error, or its changes cannot be made durable, they are rolled back and the error is returned.
+// fn is not run if ctx is done by the time the lock is acquired, and its changes are rolled back
+// if ctx is done before they are persisted. Once persisting has started it runs to completion.
+func (db *DB) Update(ctx context.Context, fn func(dbs *DBStructure) error) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	err := ctx.Err()
+	if err == nil {
+		err = fn(&db.state)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		db.state.rollback()
+		return err
+	}
+
+	if len(db.state.changes) == 0 {
+		return nil
+	}
+
+	switch {
+	case db.wal != nil:
+		err = db.wal.append(db.state.changes)
+	case db.flushInterval == 0:
+		err = db.persist(db.state)
+	}
+	if err != nil {
+		db.state.rollback()
+		return err
+	}
+
+	db.state.commit()
+	db.version++
+	if db.wal == nil && db.flushInterval == 0 {
+		db.flushed = db.version
+	}
+	return nil
+}
+
+// load reads the file from DB.path, decrypts it, unmarshalls it from JSON and returns a DBStructure.
+// stale reports whether the file is not encrypted with the primary key.
+func (db *DB) load() (dbs DBStructure, stale bool, err error) {
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return DBStructure{}, false, err
+	}
+
+	data, stale, err = db.keys.open(data)
+	if err != nil {
+		return DBStructure{}, false, err
+	}
+
+	dbs, applied, err := decode(data)
+	for _, migration := range applied {
+		log.Printf("migrated %s to version %d : %s", db.path, migration.Version, migration.Description)
+	}
+	// The file is not corrupt: recovering would move every user aside to settle the emails of a few.
+	if errors.Is(err, ErrEmailCollision) {
+		return DBStructure{}, false, err
+	}
+	if err != nil {
+		return DBStructure{}, false, fmt.Errorf("%w : %s", ErrCorrupt, err)
+	}
+
+	err = dbs.Validate()
+	if err != nil {
+		return DBStructure{}, false, fmt.Errorf("%w : %s", ErrCorrupt, err)
+	}
+	return dbs, stale, nil
+}
+
+// persist atomically replaces the file from DB.path with the encrypted JSON encoding of a given DBStructure.
+func (db *DB) persist(dbs DBStructure) error {
+	if db.path == "" {
+		return nil
+	}
+
 	data, err := json.MarshalIndent(dbs, "", "\t")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(db.path, data, 0644)
+	data, err = db.keys.seal(data)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(db.path, data, fileMode)
 }
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/id"
+)
+
+func TestNewOpensExistingDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	db, err := New(path, Options{})
+	assertNoError(t, err)
+
+	err = db.Update(context.Background(), func(dbs *DBStructure) error {
+		dbs.PutUser(User{ID: "1", Email: "a@example.com"})
+		return nil
+	})
+	assertNoError(t, err)
+
+	t.Run("keeps data across restarts", func(t *testing.T) {
+		db, err := New(path, Options{})
+		assertNoError(t, err)
+
+		assertUsers(t, db, 1)
+	})
+
+	t.Run("reset truncates", func(t *testing.T) {
+		db, err := New(path, Options{Reset: true})
+		assertNoError(t, err)
+
+		assertUsers(t, db, 0)
+	})
+}
+
+func TestNewCorruptDatabase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "database.json")
+	assertNoError(t, os.WriteFile(path, []byte(`{"chirps": {`), 0644))
+
+	t.Run("refuses to open", func(t *testing.T) {
+		_, err := New(path, Options{})
+		if !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("got: %v\nwant: %v", err, ErrCorrupt)
+		}
+	})
+
+	t.Run("recovers by moving the file aside", func(t *testing.T) {
+		db, err := New(path, Options{Recover: true})
+		assertNoError(t, err)
+
+		assertUsers(t, db, 0)
+
+		matches, _ := filepath.Glob(path + ".corrupt-*")
+		if len(matches) != 1 {
+			t.Errorf("got %d corrupt files moved aside, want 1", len(matches))
+		}
+	})
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %q", err)
+	}
+}
+
+func assertUsers(t testing.TB, db *DB, want int) {
+	t.Helper()
+
+	err := db.View(context.Background(), func(dbs *DBStructure) error {
+		if got := len(dbs.Users); got != want {
+			t.Errorf("got %d users, want %d", got, want)
+		}
+		return nil
+	})
+	assertNoError(t, err)
+}
+
+func TestFlushInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	db, err := New(path, Options{FlushInterval: time.Hour})
+	assertNoError(t, err)
+	putUsers(t, db, 2)
+
+	// Reads are served from memory before anything is flushed.
+	assertUsers(t, db, 2)
+	assertFileUsers(t, path, 0)
+
+	assertNoError(t, db.Flush())
+	assertFileUsers(t, path, 2)
+
+	putUsers(t, db, 3)
+	assertNoError(t, db.Close())
+	assertFileUsers(t, path, 3)
+}
+
+// assertFileUsers checks the number of users in the database file, regardless of what is in memory.
+func assertFileUsers(t testing.TB, path string, want int) {
+	t.Helper()
+
+	db := &DB{path: path}
+	dbs, _, err := db.load()
+	assertNoError(t, err)
+	if got := len(dbs.Users); got != want {
+		t.Errorf("got %d users in the file, want %d", got, want)
+	}
+}
+
+func TestMigrateLegacyIntegerIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	older := `{
+		"chirps": {"1": {"id": 1, "body": "a", "author_id": 1}, "3": {"id": 3, "body": "b", "author_id": 1}},
+		"users": {"1": {"id": 1, "email": "a@example.com"}},
+		"revoked_tokens": {}
+	}`
+	assertNoError(t, os.WriteFile(path, []byte(older), 0644))
+
+	db, err := New(path, Options{})
+	assertNoError(t, err)
+
+	db.View(context.Background(), func(dbs *DBStructure) error {
+		chirp, ok := dbs.Chirps[id.Legacy(3)]
+		if !ok || chirp.Body != "b" || chirp.UserID != id.Legacy(1) {
+			t.Errorf("chirp 3 was not migrated: %+v", dbs.Chirps)
+		}
+		if _, ok := dbs.Users[id.Legacy(1)]; !ok {
+			t.Errorf("user 1 was not migrated: %+v", dbs.Users)
+		}
+		return nil
+	})
+}
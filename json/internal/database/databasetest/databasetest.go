@@ -0,0 +1,1157 @@
+// Package databasetest is a conformance suite for the repositories of the database package.
+// Every storage backend runs it against its repositories, so that they are interchangeable:
+//
+//	func TestRepositories(t *testing.T) {
+//		databasetest.RunSuite(t, func(t *testing.T) databasetest.Repositories {
+//			...
+//		})
+//	}
+package databasetest
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+)
+
+// Repositories are the repositories of a single database.
+type Repositories struct {
+	Chirps        database.ChirpRepository
+	Users         database.UserRepository
+	RevokedTokens database.RevokedTokensRepository
+	Events        database.EventRepository
+	Follows       database.FollowRepository
+}
+
+// Factory returns the repositories of a new, empty database that is released when t ends.
+type Factory func(t *testing.T) Repositories
+
+// concurrency is the number of goroutines of the concurrent tests.
+const concurrency = 20
+
+// RunSuite runs every conformance test.
+func RunSuite(t *testing.T, factory Factory) {
+	t.Run("ChirpRepository", func(t *testing.T) { RunChirpRepositorySuite(t, factory) })
+	t.Run("UserRepository", func(t *testing.T) { RunUserRepositorySuite(t, factory) })
+	t.Run("RevokedTokensRepository", func(t *testing.T) { RunRevokedTokensRepositorySuite(t, factory) })
+	t.Run("EventRepository", func(t *testing.T) { RunEventRepositorySuite(t, factory) })
+	t.Run("FollowRepository", func(t *testing.T) { RunFollowRepositorySuite(t, factory) })
+}
+
+// RunChirpRepositorySuite checks that the ChirpRepository of the databases made by factory behaves as specified.
+func RunChirpRepositorySuite(t *testing.T, factory Factory) {
+	ctx := context.Background()
+
+	t.Run("get unknown chirp", func(t *testing.T) {
+		repos := factory(t)
+
+		_, err := repos.Chirps.GetByID(ctx, "unknown")
+		assertError(t, err, database.ErrChirpNotFound)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+		chirp := createChirps(t, repos, author.ID, 1)[0]
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := repos.Chirps.Create(cancelled, database.CreateChirpParams{Body: "Hello", UserID: author.ID})
+		assertCanceled(t, err)
+		err = repos.Chirps.Delete(cancelled, database.DeleteChirpParams{ID: chirp.ID, UserID: author.ID})
+		assertCanceled(t, err)
+		_, err = repos.Chirps.GetAll(cancelled)
+		assertCanceled(t, err)
+
+		all, err := repos.Chirps.GetAll(ctx)
+		assertNoError(t, err)
+		assertChirps(t, all, []database.Chirp{chirp})
+	})
+
+	t.Run("create and get", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+
+		created, err := repos.Chirps.Create(ctx, database.CreateChirpParams{
+			Body:     "Hello #chirpy #go",
+			UserID:   author.ID,
+			Hashtags: []string{"chirpy", "go"},
+		})
+		assertNoError(t, err)
+		want := database.Chirp{
+			ID:       created.ID,
+			Body:     "Hello #chirpy #go",
+			UserID:   author.ID,
+			Hashtags: []string{"chirpy", "go"},
+			Version:  1,
+		}
+		if !reflect.DeepEqual(created, want) || created.ID == "" {
+			t.Fatalf("got: %+v\nwant: %+v with an ID", created, want)
+		}
+
+		got, err := repos.Chirps.GetByID(ctx, created.ID)
+		assertNoError(t, err)
+		if !reflect.DeepEqual(got, created) {
+			t.Errorf("got: %+v\nwant: %+v", got, created)
+		}
+	})
+
+	t.Run("IDs sort by creation time", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+
+		chirps := createChirps(t, repos, author.ID, 10)
+		ids := chirpIDs(chirps)
+		if !slices.IsSorted(ids) {
+			t.Errorf("IDs %v are not sorted", ids)
+		}
+	})
+
+	t.Run("get all and by author", func(t *testing.T) {
+		repos := factory(t)
+		alice := createUser(t, repos, "alice@example.com")
+		bob := createUser(t, repos, "bob@example.com")
+		aliceChirps := createChirps(t, repos, alice.ID, 2)
+		bobChirps := createChirps(t, repos, bob.ID, 3)
+
+		all, err := repos.Chirps.GetAll(ctx)
+		assertNoError(t, err)
+		assertChirps(t, all, append(aliceChirps, bobChirps...))
+
+		byBob, err := repos.Chirps.GetByUserID(ctx, bob.ID)
+		assertNoError(t, err)
+		assertChirps(t, byBob, bobChirps)
+
+		byNobody, err := repos.Chirps.GetByUserID(ctx, "unknown")
+		assertNoError(t, err)
+		assertChirps(t, byNobody, nil)
+	})
+
+	t.Run("list pages", func(t *testing.T) {
+		repos := factory(t)
+		alice := createUser(t, repos, "alice@example.com")
+		bob := createUser(t, repos, "bob@example.com")
+		aliceChirps := createChirps(t, repos, alice.ID, 4)
+		bobChirps := createChirps(t, repos, bob.ID, 3)
+		aliceChirps = append(aliceChirps, createChirps(t, repos, alice.ID, 3)...)
+		deleted := aliceChirps[2]
+		assertNoError(t, repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: deleted.ID, UserID: alice.ID}))
+
+		all := slices.DeleteFunc(append(slices.Clone(aliceChirps), bobChirps...), func(chirp database.Chirp) bool {
+			return chirp.ID == deleted.ID
+		})
+		slices.SortFunc(all, func(a, b database.Chirp) int { return cmp.Compare(a.ID, b.ID) })
+		byAlice := slices.DeleteFunc(slices.Clone(all), func(chirp database.Chirp) bool { return chirp.UserID != alice.ID })
+
+		for _, test := range []struct {
+			Desc     string
+			AuthorID string
+			Want     []database.Chirp
+		}{
+			{Desc: "all", Want: all},
+			{Desc: "by author", AuthorID: alice.ID, Want: byAlice},
+			{Desc: "by unknown author", AuthorID: "unknown", Want: nil},
+		} {
+			for _, desc := range []bool{false, true} {
+				want := slices.Clone(test.Want)
+				if desc {
+					slices.Reverse(want)
+				}
+
+				var got []database.Chirp
+				params := database.ListChirpsParams{AuthorID: test.AuthorID, Desc: desc, Limit: 2}
+				for {
+					page, err := repos.Chirps.List(ctx, params)
+					assertNoError(t, err)
+					if len(page) > params.Limit {
+						t.Fatalf("%s: got a page of %d chirps, want at most %d", test.Desc, len(page), params.Limit)
+					}
+					got = append(got, page...)
+					if len(page) < params.Limit {
+						break
+					}
+					params.After = page[len(page)-1].ID
+				}
+
+				if !slices.Equal(chirpIDs(got), chirpIDs(want)) {
+					t.Errorf("%s, desc %t:\ngot: %v\nwant: %v", test.Desc, desc, chirpIDs(got), chirpIDs(want))
+				}
+			}
+		}
+	})
+
+	t.Run("list by hashtag", func(t *testing.T) {
+		repos := factory(t)
+		alice := createUser(t, repos, "alice@example.com")
+		bob := createUser(t, repos, "bob@example.com")
+		create := func(userID string, hashtags ...string) database.Chirp {
+			t.Helper()
+
+			chirp, err := repos.Chirps.Create(ctx, database.CreateChirpParams{Body: "tagged", UserID: userID, Hashtags: hashtags})
+			assertNoError(t, err)
+			return chirp
+		}
+		first := create(alice.ID, "go", "chirpy")
+		create(alice.ID, "rust")
+		deleted := create(alice.ID, "go")
+		third := create(bob.ID, "chirpy", "go")
+		assertNoError(t, repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: deleted.ID, UserID: alice.ID}))
+
+		for _, test := range []struct {
+			Params database.ListChirpsParams
+			Want   []database.Chirp
+		}{
+			{Params: database.ListChirpsParams{Hashtag: "go", Limit: 10}, Want: []database.Chirp{first, third}},
+			{Params: database.ListChirpsParams{Hashtag: "go", Desc: true, Limit: 1}, Want: []database.Chirp{third}},
+			{Params: database.ListChirpsParams{Hashtag: "go", After: first.ID, Limit: 10}, Want: []database.Chirp{third}},
+			{Params: database.ListChirpsParams{Hashtag: "go", AuthorID: alice.ID, Limit: 10}, Want: []database.Chirp{first}},
+			{Params: database.ListChirpsParams{Hashtag: "unknown", Limit: 10}, Want: nil},
+		} {
+			got, err := repos.Chirps.List(ctx, test.Params)
+			assertNoError(t, err)
+			if !slices.Equal(chirpIDs(got), chirpIDs(test.Want)) {
+				t.Errorf("%+v:\ngot: %v\nwant: %v", test.Params, chirpIDs(got), chirpIDs(test.Want))
+			}
+		}
+	})
+
+	t.Run("list by mention", func(t *testing.T) {
+		repos := factory(t)
+		alice := createUser(t, repos, "alice@example.com")
+		bob := createUser(t, repos, "bob@example.com")
+		create := func(userID string, mentioned ...database.User) database.Chirp {
+			t.Helper()
+
+			body := ""
+			mentions := []database.Mention{}
+			for i, user := range mentioned {
+				handle := fmt.Sprint("user", i)
+				mentions = append(mentions, database.Mention{
+					UserID: user.ID,
+					Handle: handle,
+					Start:  len(body),
+					End:    len(body) + 1 + len(handle),
+				})
+				body += "@" + handle + " "
+			}
+			chirp, err := repos.Chirps.Create(ctx, database.CreateChirpParams{Body: body, UserID: userID, Mentions: mentions})
+			assertNoError(t, err)
+			return chirp
+		}
+		first := create(alice.ID, bob, bob)
+		create(alice.ID, alice)
+		deleted := create(alice.ID, bob)
+		third := create(bob.ID, alice, bob)
+		assertNoError(t, repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: deleted.ID, UserID: alice.ID}))
+
+		got, err := repos.Chirps.GetByID(ctx, first.ID)
+		assertNoError(t, err)
+		if !reflect.DeepEqual(got.Mentions, first.Mentions) {
+			t.Errorf("got mentions %+v, want %+v", got.Mentions, first.Mentions)
+		}
+
+		for _, test := range []struct {
+			Params database.ListChirpsParams
+			Want   []database.Chirp
+		}{
+			{Params: database.ListChirpsParams{MentionedUserID: bob.ID, Limit: 10}, Want: []database.Chirp{first, third}},
+			{Params: database.ListChirpsParams{MentionedUserID: bob.ID, Desc: true, Limit: 1}, Want: []database.Chirp{third}},
+			{Params: database.ListChirpsParams{MentionedUserID: bob.ID, After: first.ID, Limit: 10}, Want: []database.Chirp{third}},
+			{Params: database.ListChirpsParams{MentionedUserID: bob.ID, AuthorID: alice.ID, Limit: 10}, Want: []database.Chirp{first}},
+			{Params: database.ListChirpsParams{MentionedUserID: "unknown", Limit: 10}, Want: nil},
+		} {
+			got, err := repos.Chirps.List(ctx, test.Params)
+			assertNoError(t, err)
+			if !slices.Equal(chirpIDs(got), chirpIDs(test.Want)) {
+				t.Errorf("%+v:\ngot: %v\nwant: %v", test.Params, chirpIDs(got), chirpIDs(test.Want))
+			}
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+		other := createUser(t, repos, "other@example.com")
+		chirps := createChirps(t, repos, author.ID, 2)
+
+		err := repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: "unknown", UserID: author.ID})
+		assertError(t, err, database.ErrChirpNotFound)
+
+		err = repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: chirps[0].ID, UserID: other.ID})
+		assertError(t, err, database.ErrChirpNotAuthor)
+		_, err = repos.Chirps.GetByID(ctx, chirps[0].ID)
+		assertNoError(t, err)
+
+		err = repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: chirps[0].ID, UserID: author.ID})
+		assertNoError(t, err)
+		_, err = repos.Chirps.GetByID(ctx, chirps[0].ID)
+		assertError(t, err, database.ErrChirpNotFound)
+
+		err = repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: chirps[0].ID, UserID: author.ID})
+		assertError(t, err, database.ErrChirpNotFound)
+
+		all, err := repos.Chirps.GetAll(ctx)
+		assertNoError(t, err)
+		assertChirps(t, all, chirps[1:])
+		byAuthor, err := repos.Chirps.GetByUserID(ctx, author.ID)
+		assertNoError(t, err)
+		assertChirps(t, byAuthor, chirps[1:])
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+		other := createUser(t, repos, "other@example.com")
+		chirp := createChirps(t, repos, author.ID, 1)[0]
+		params := database.RestoreChirpParams{ID: chirp.ID, UserID: author.ID, DeletedSince: time.Now().Add(-time.Hour)}
+
+		_, err := repos.Chirps.Restore(ctx, params)
+		assertError(t, err, database.ErrChirpNotDeleted)
+		_, err = repos.Chirps.Restore(ctx, database.RestoreChirpParams{ID: "unknown", UserID: author.ID})
+		assertError(t, err, database.ErrChirpNotFound)
+
+		err = repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: chirp.ID, UserID: author.ID})
+		assertNoError(t, err)
+
+		_, err = repos.Chirps.Restore(ctx, database.RestoreChirpParams{ID: chirp.ID, UserID: other.ID})
+		assertError(t, err, database.ErrChirpNotAuthor)
+		expired := params
+		expired.DeletedSince = time.Now().Add(time.Hour)
+		_, err = repos.Chirps.Restore(ctx, expired)
+		assertError(t, err, database.ErrChirpNotFound)
+
+		restored, err := repos.Chirps.Restore(ctx, params)
+		assertNoError(t, err)
+		want := chirp
+		want.Version = 3
+		if !reflect.DeepEqual(restored, want) {
+			t.Errorf("got: %+v\nwant: %+v", restored, want)
+		}
+		got, err := repos.Chirps.GetByID(ctx, chirp.ID)
+		assertNoError(t, err)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %+v\nwant: %+v", got, want)
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+		chirps := createChirps(t, repos, author.ID, 3)
+		for _, chirp := range chirps[:2] {
+			err := repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: chirp.ID, UserID: author.ID})
+			assertNoError(t, err)
+		}
+
+		purged, err := repos.Chirps.Purge(ctx, time.Now().Add(-time.Hour))
+		assertNoError(t, err)
+		if purged != 0 {
+			t.Errorf("purged %d chirps deleted within the window, want 0", purged)
+		}
+
+		purged, err = repos.Chirps.Purge(ctx, time.Now().Add(time.Hour))
+		assertNoError(t, err)
+		if purged != 2 {
+			t.Errorf("purged %d chirps, want 2", purged)
+		}
+
+		_, err = repos.Chirps.Restore(ctx, database.RestoreChirpParams{ID: chirps[0].ID, UserID: author.ID})
+		assertError(t, err, database.ErrChirpNotFound)
+		all, err := repos.Chirps.GetAll(ctx)
+		assertNoError(t, err)
+		assertChirps(t, all, chirps[2:])
+	})
+
+	t.Run("versions", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+		chirp := createChirps(t, repos, author.ID, 1)[0]
+
+		err := repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: chirp.ID, UserID: author.ID, IfVersions: database.Versions{2}})
+		assertError(t, err, database.ErrChirpVersionMismatch)
+		_, err = repos.Chirps.GetByID(ctx, chirp.ID)
+		assertNoError(t, err)
+
+		err = repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: chirp.ID, UserID: author.ID, IfVersions: database.Versions{1}})
+		assertNoError(t, err)
+
+		params := database.RestoreChirpParams{ID: chirp.ID, UserID: author.ID, IfVersions: database.Versions{1}}
+		_, err = repos.Chirps.Restore(ctx, params)
+		assertError(t, err, database.ErrChirpVersionMismatch)
+
+		params.IfVersions = database.Versions{2}
+		restored, err := repos.Chirps.Restore(ctx, params)
+		assertNoError(t, err)
+		if restored.Version != 3 {
+			t.Errorf("got version %d, want 3", restored.Version)
+		}
+	})
+
+	t.Run("IDs are never reused after deletes", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+
+		seen := map[string]bool{}
+		for i := 0; i < 5; i++ {
+			chirp := createChirps(t, repos, author.ID, 1)[0]
+			if seen[chirp.ID] {
+				t.Fatalf("ID %q was reused", chirp.ID)
+			}
+			seen[chirp.ID] = true
+
+			err := repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: chirp.ID, UserID: author.ID})
+			assertNoError(t, err)
+		}
+	})
+
+	t.Run("concurrent access", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+
+		created := make([]database.Chirp, concurrency)
+		parallel(t, func(i int) error {
+			chirp, err := repos.Chirps.Create(ctx, database.CreateChirpParams{Body: fmt.Sprint(i), UserID: author.ID})
+			if err != nil {
+				return err
+			}
+			created[i] = chirp
+
+			_, err = repos.Chirps.GetAll(ctx)
+			return err
+		})
+
+		all, err := repos.Chirps.GetAll(ctx)
+		assertNoError(t, err)
+		assertChirps(t, all, created)
+
+		parallel(t, func(i int) error {
+			return repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: created[i].ID, UserID: author.ID})
+		})
+
+		all, err = repos.Chirps.GetAll(ctx)
+		assertNoError(t, err)
+		assertChirps(t, all, nil)
+	})
+}
+
+// RunUserRepositorySuite checks that the UserRepository of the databases made by factory behaves as specified.
+func RunUserRepositorySuite(t *testing.T, factory Factory) {
+	ctx := context.Background()
+
+	t.Run("unknown user", func(t *testing.T) {
+		repos := factory(t)
+
+		_, err := repos.Users.GetByID(ctx, "unknown")
+		assertError(t, err, database.ErrUserNotFound)
+		_, err = repos.Users.GetByEmail(ctx, "unknown@example.com")
+		assertError(t, err, database.ErrUserNotFound)
+		_, err = repos.Users.Update(ctx, "unknown", database.UpdateUserParams{Email: ptr("unknown@example.com")})
+		assertError(t, err, database.ErrUserNotFound)
+		_, err = repos.Users.UpgradeToRed(ctx, "unknown")
+		assertError(t, err, database.ErrUserNotFound)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		repos := factory(t)
+		user := createUser(t, repos, "user@example.com")
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := repos.Users.Create(cancelled, database.CreateUserParams{Email: "other@example.com"})
+		assertCanceled(t, err)
+		_, err = repos.Users.Update(cancelled, user.ID, database.UpdateUserParams{Email: ptr("new@example.com")})
+		assertCanceled(t, err)
+		_, err = repos.Users.GetByID(cancelled, user.ID)
+		assertCanceled(t, err)
+
+		all, err := repos.Users.GetAll(ctx)
+		assertNoError(t, err)
+		if len(all) != 1 || all[0] != user {
+			t.Errorf("got: %+v\nwant: [%+v]", all, user)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		repos := factory(t)
+		var want []string
+		for i := 0; i < 5; i++ {
+			want = append(want, createUser(t, repos, fmt.Sprintf("user%d@example.com", i)).ID)
+		}
+		slices.Sort(want)
+
+		var got []string
+		params := database.ListUsersParams{Limit: 2}
+		for {
+			page, err := repos.Users.List(ctx, params)
+			assertNoError(t, err)
+			if len(page) > params.Limit {
+				t.Fatalf("got a page of %d users, want at most %d", len(page), params.Limit)
+			}
+			for _, user := range page {
+				got = append(got, user.ID)
+			}
+			if len(page) < params.Limit {
+				break
+			}
+			params.After = page[len(page)-1].ID
+		}
+
+		if !slices.Equal(got, want) {
+			t.Errorf("got: %v\nwant: %v", got, want)
+		}
+	})
+
+	t.Run("create and get", func(t *testing.T) {
+		repos := factory(t)
+
+		created, err := repos.Users.Create(ctx, database.CreateUserParams{Email: "user@example.com", Password: "hash"})
+		assertNoError(t, err)
+		want := database.User{ID: created.ID, Email: "user@example.com", Password: "hash", Version: 1}
+		if created != want || created.ID == "" {
+			t.Fatalf("got: %+v\nwant: %+v with an ID", created, want)
+		}
+
+		byID, err := repos.Users.GetByID(ctx, created.ID)
+		assertNoError(t, err)
+		byEmail, err := repos.Users.GetByEmail(ctx, created.Email)
+		assertNoError(t, err)
+		if byID != created || byEmail != created {
+			t.Errorf("got: %+v and %+v\nwant: %+v", byID, byEmail, created)
+		}
+
+		all, err := repos.Users.GetAll(ctx)
+		assertNoError(t, err)
+		if len(all) != 1 || all[0] != created {
+			t.Errorf("got: %+v\nwant: [%+v]", all, created)
+		}
+	})
+
+	t.Run("emails are unique", func(t *testing.T) {
+		repos := factory(t)
+		alice := createUser(t, repos, "alice@example.com")
+		bob := createUser(t, repos, "bob@example.com")
+
+		_, err := repos.Users.Create(ctx, database.CreateUserParams{Email: alice.Email})
+		assertError(t, err, database.ErrUserEmailTaken)
+
+		_, err = repos.Users.Update(ctx, bob.ID, database.UpdateUserParams{Email: ptr(alice.Email)})
+		assertError(t, err, database.ErrUserEmailTaken)
+		got, err := repos.Users.GetByID(ctx, bob.ID)
+		assertNoError(t, err)
+		if got != bob {
+			t.Errorf("got: %+v\nwant: %+v", got, bob)
+		}
+
+		_, err = repos.Users.Update(ctx, alice.ID, database.UpdateUserParams{Email: ptr(alice.Email), Password: ptr("new")})
+		assertNoError(t, err)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repos := factory(t)
+		user := createUser(t, repos, "old@example.com")
+
+		updated, err := repos.Users.Update(ctx, user.ID, database.UpdateUserParams{Email: ptr("new@example.com"), Password: ptr("new")})
+		assertNoError(t, err)
+		want := database.User{ID: user.ID, Email: "new@example.com", Password: "new", Version: 2}
+		if updated != want {
+			t.Fatalf("got: %+v\nwant: %+v", updated, want)
+		}
+
+		_, err = repos.Users.GetByEmail(ctx, "old@example.com")
+		assertError(t, err, database.ErrUserNotFound)
+		got, err := repos.Users.GetByEmail(ctx, "new@example.com")
+		assertNoError(t, err)
+		if got != want {
+			t.Errorf("got: %+v\nwant: %+v", got, want)
+		}
+
+		_, err = repos.Users.Create(ctx, database.CreateUserParams{Email: "old@example.com"})
+		assertNoError(t, err)
+	})
+
+	t.Run("handles", func(t *testing.T) {
+		repos := factory(t)
+		alice, err := repos.Users.Create(ctx, database.CreateUserParams{Email: "alice@example.com", Handle: "alice"})
+		assertNoError(t, err)
+		bob := createUser(t, repos, "bob@example.com")
+		createUser(t, repos, "carol@example.com")
+
+		_, err = repos.Users.Create(ctx, database.CreateUserParams{Email: "other@example.com", Handle: "alice"})
+		assertError(t, err, database.ErrUserHandleTaken)
+		_, err = repos.Users.GetByHandle(ctx, "")
+		assertError(t, err, database.ErrUserNotFound)
+		_, err = repos.Users.GetByHandle(ctx, "nobody")
+		assertError(t, err, database.ErrUserNotFound)
+
+		assertHandle := func(handle, wantID, wantHandle string) {
+			t.Helper()
+
+			got, err := repos.Users.GetByHandle(ctx, handle)
+			assertNoError(t, err)
+			if got.ID != wantID || got.Handle != wantHandle {
+				t.Errorf("%s : got user %s with handle %q, want %s with %q", handle, got.ID, got.Handle, wantID, wantHandle)
+			}
+		}
+		assertHandle("alice", alice.ID, "alice")
+
+		update := func(user database.User, handle string, unchangedSince time.Time) (database.User, error) {
+			return repos.Users.Update(ctx, user.ID, database.UpdateUserParams{
+				Email:                ptr(user.Email),
+				Handle:               &handle,
+				HandleUnchangedSince: unchangedSince,
+			})
+		}
+
+		_, err = update(bob, "alice", time.Time{})
+		assertError(t, err, database.ErrUserHandleTaken)
+
+		// Picking the first handle is not a change.
+		bob, err = update(bob, "bob", time.Now())
+		assertNoError(t, err)
+		if bob.Handle != "bob" || bob.PreviousHandle != "" || bob.HandleChangedAt != nil {
+			t.Errorf("got: %+v\nwant: handle bob, never changed", bob)
+		}
+
+		before := time.Now()
+		alice, err = update(alice, "alice2", time.Time{})
+		assertNoError(t, err)
+		if alice.PreviousHandle != "alice" || alice.HandleChangedAt == nil || alice.HandleChangedAt.Before(before.Add(-time.Second)) {
+			t.Errorf("got: %+v\nwant: previous handle alice, changed just now", alice)
+		}
+		// The previous handle still leads to the user.
+		assertHandle("alice", alice.ID, "alice2")
+		assertHandle("alice2", alice.ID, "alice2")
+
+		_, err = update(alice, "alice3", time.Now().Add(-time.Hour))
+		assertError(t, err, database.ErrUserHandleChangedRecently)
+		// Without a limit, the handle can change again right away.
+		alice, err = update(alice, "alice3", time.Time{})
+		assertNoError(t, err)
+		alice, err = update(alice, "alice2", time.Time{})
+		assertNoError(t, err)
+
+		// Until someone else takes it.
+		bob, err = update(bob, "alice", time.Now().Add(-time.Hour))
+		assertNoError(t, err)
+		assertHandle("alice", bob.ID, "alice")
+		assertHandle("bob", bob.ID, "alice")
+	})
+
+	t.Run("profiles", func(t *testing.T) {
+		repos := factory(t)
+		user := createUser(t, repos, "user@example.com")
+
+		displayName, bio, location, website := "User", "Chirping", "Athens", "https://example.com"
+		updated, err := repos.Users.Update(ctx, user.ID, database.UpdateUserParams{
+			Email:       ptr(user.Email),
+			DisplayName: &displayName,
+			Bio:         &bio,
+			Location:    &location,
+			Website:     &website,
+		})
+		assertNoError(t, err)
+		want := database.Profile{DisplayName: displayName, Bio: bio, Location: location, Website: website}
+		if updated.Profile != want {
+			t.Fatalf("got: %+v\nwant: %+v", updated.Profile, want)
+		}
+
+		// Fields left out are unchanged, the email and password included.
+		updated, err = repos.Users.Update(ctx, user.ID, database.UpdateUserParams{Bio: ptr("")})
+		assertNoError(t, err)
+		want.Bio = ""
+		got, err := repos.Users.GetByID(ctx, user.ID)
+		assertNoError(t, err)
+		if updated.Profile != want || got.Profile != want {
+			t.Errorf("got: %+v and %+v\nwant: %+v", updated.Profile, got.Profile, want)
+		}
+		if got.Email != user.Email || got.Password != user.Password {
+			t.Errorf("got email %q and password %q, want %q and %q", got.Email, got.Password, user.Email, user.Password)
+		}
+	})
+
+	t.Run("versions", func(t *testing.T) {
+		repos := factory(t)
+		user := createUser(t, repos, "user@example.com")
+
+		params := database.UpdateUserParams{Email: ptr("new@example.com"), Password: ptr("new"), IfVersions: database.Versions{1}}
+		updated, err := repos.Users.Update(ctx, user.ID, params)
+		assertNoError(t, err)
+		if updated.Version != 2 {
+			t.Fatalf("got version %d, want 2", updated.Version)
+		}
+
+		_, err = repos.Users.Update(ctx, user.ID, database.UpdateUserParams{Email: ptr("stale@example.com"), IfVersions: database.Versions{1}})
+		assertError(t, err, database.ErrUserVersionMismatch)
+		got, err := repos.Users.GetByID(ctx, user.ID)
+		assertNoError(t, err)
+		if got != updated {
+			t.Errorf("got: %+v\nwant: %+v", got, updated)
+		}
+
+		_, err = repos.Users.Update(ctx, "unknown", params)
+		assertError(t, err, database.ErrUserNotFound)
+
+		upgraded, err := repos.Users.UpgradeToRed(ctx, user.ID)
+		assertNoError(t, err)
+		if upgraded.Version != 3 {
+			t.Errorf("got version %d, want 3", upgraded.Version)
+		}
+	})
+
+	t.Run("upgrade to red", func(t *testing.T) {
+		repos := factory(t)
+		user := createUser(t, repos, "user@example.com")
+
+		for i := 0; i < 2; i++ {
+			upgraded, err := repos.Users.UpgradeToRed(ctx, user.ID)
+			assertNoError(t, err)
+			if !upgraded.IsChirpyRed {
+				t.Fatalf("got: %+v\nwant: a Chirpy Red user", upgraded)
+			}
+		}
+
+		got, err := repos.Users.GetByID(ctx, user.ID)
+		assertNoError(t, err)
+		if !got.IsChirpyRed {
+			t.Errorf("got: %+v\nwant: a Chirpy Red user", got)
+		}
+	})
+
+	t.Run("concurrent access", func(t *testing.T) {
+		repos := factory(t)
+
+		mu := &sync.Mutex{}
+		ids := map[string]bool{}
+		taken := 0
+		parallel(t, func(i int) error {
+			user, err := repos.Users.Create(ctx, database.CreateUserParams{Email: fmt.Sprintf("user%d@example.com", i)})
+			if err != nil {
+				return err
+			}
+			_, err = repos.Users.Create(ctx, database.CreateUserParams{Email: "same@example.com"})
+			if err != nil && err != database.ErrUserEmailTaken {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			ids[user.ID] = true
+			if err == database.ErrUserEmailTaken {
+				taken++
+			}
+			return nil
+		})
+
+		if len(ids) != concurrency {
+			t.Errorf("got %d distinct IDs, want %d", len(ids), concurrency)
+		}
+		if taken != concurrency-1 {
+			t.Errorf("got %d creations of the same email rejected, want %d", taken, concurrency-1)
+		}
+	})
+}
+
+// RunRevokedTokensRepositorySuite checks that the RevokedTokensRepository of the databases made by factory
+// behaves as specified.
+// RunFollowRepositorySuite runs the conformance tests of a FollowRepository.
+func RunFollowRepositorySuite(t *testing.T, factory Factory) {
+	ctx := context.Background()
+
+	t.Run("follow and unfollow", func(t *testing.T) {
+		repos := factory(t)
+		alice := createUser(t, repos, "alice@example.com")
+		bob := createUser(t, repos, "bob@example.com")
+		carol := createUser(t, repos, "carol@example.com")
+
+		assertFollowers := func(userID string, want int) {
+			t.Helper()
+
+			got, err := repos.Follows.CountFollowers(ctx, userID)
+			assertNoError(t, err)
+			if got != want {
+				t.Errorf("got %d followers, want %d", got, want)
+			}
+		}
+
+		assertFollowers(alice.ID, 0)
+		assertNoError(t, repos.Follows.Follow(ctx, database.Follow{FollowerID: bob.ID, FolloweeID: alice.ID}))
+		assertNoError(t, repos.Follows.Follow(ctx, database.Follow{FollowerID: carol.ID, FolloweeID: alice.ID}))
+		assertNoError(t, repos.Follows.Follow(ctx, database.Follow{FollowerID: bob.ID, FolloweeID: alice.ID}))
+		assertFollowers(alice.ID, 2)
+		assertFollowers(bob.ID, 0)
+
+		err := repos.Follows.Follow(ctx, database.Follow{FollowerID: bob.ID, FolloweeID: "unknown"})
+		assertError(t, err, database.ErrUserNotFound)
+
+		assertNoError(t, repos.Follows.Unfollow(ctx, database.Follow{FollowerID: bob.ID, FolloweeID: alice.ID}))
+		assertNoError(t, repos.Follows.Unfollow(ctx, database.Follow{FollowerID: bob.ID, FolloweeID: alice.ID}))
+		assertFollowers(alice.ID, 1)
+
+		// Only the changes are events: following again and unfollowing twice are not.
+		events, err := repos.Events.After(ctx, 0, 100)
+		assertNoError(t, err)
+		var types []database.EventType
+		for _, event := range events {
+			if event.Follow != nil {
+				types = append(types, event.Type)
+			}
+		}
+		want := []database.EventType{
+			database.EventUserFollowed,
+			database.EventUserFollowed,
+			database.EventUserUnfollowed,
+		}
+		if !slices.Equal(types, want) {
+			t.Errorf("got events %v, want %v", types, want)
+		}
+	})
+
+	t.Run("concurrent access", func(t *testing.T) {
+		repos := factory(t)
+		followee := createUser(t, repos, "followee@example.com")
+		followers := make([]database.User, concurrency)
+		for i := range followers {
+			followers[i] = createUser(t, repos, fmt.Sprintf("follower%d@example.com", i))
+		}
+
+		parallel(t, func(i int) error {
+			return repos.Follows.Follow(ctx, database.Follow{FollowerID: followers[i].ID, FolloweeID: followee.ID})
+		})
+
+		got, err := repos.Follows.CountFollowers(ctx, followee.ID)
+		assertNoError(t, err)
+		if got != concurrency {
+			t.Errorf("got %d followers, want %d", got, concurrency)
+		}
+	})
+}
+
+func RunRevokedTokensRepositorySuite(t *testing.T, factory Factory) {
+	ctx := context.Background()
+
+	t.Run("revoke", func(t *testing.T) {
+		repos := factory(t)
+
+		assertRevoked(t, repos, "token", false)
+		assertNoError(t, repos.RevokedTokens.Revoke(ctx, "token"))
+		assertRevoked(t, repos, "token", true)
+		assertRevoked(t, repos, "other", false)
+
+		assertNoError(t, repos.RevokedTokens.Revoke(ctx, "token"))
+		assertRevoked(t, repos, "token", true)
+	})
+
+	t.Run("concurrent access", func(t *testing.T) {
+		repos := factory(t)
+
+		parallel(t, func(i int) error {
+			err := repos.RevokedTokens.Revoke(ctx, fmt.Sprint(i%2))
+			if err != nil {
+				return err
+			}
+			_, err = repos.RevokedTokens.IsRevoked(ctx, "token")
+			return err
+		})
+
+		assertRevoked(t, repos, "0", true)
+		assertRevoked(t, repos, "1", true)
+	})
+}
+
+// RunEventRepositorySuite checks that the other repositories of the databases made by factory store an event
+// for every change, and that their EventRepository behaves as specified.
+func RunEventRepositorySuite(t *testing.T, factory Factory) {
+	ctx := context.Background()
+
+	t.Run("every change stores an event", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+		other := createUser(t, repos, "other@example.com")
+		chirp := createChirps(t, repos, author.ID, 1)[0]
+
+		_, err := repos.Users.Update(ctx, author.ID, database.UpdateUserParams{Email: ptr("new@example.com"), Password: ptr("hash")})
+		assertNoError(t, err)
+		_, err = repos.Users.UpgradeToRed(ctx, author.ID)
+		assertNoError(t, err)
+		err = repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: chirp.ID, UserID: other.ID})
+		assertError(t, err, database.ErrChirpNotAuthor)
+		assertNoError(t, repos.Chirps.Delete(ctx, database.DeleteChirpParams{ID: chirp.ID, UserID: author.ID}))
+		_, err = repos.Chirps.Restore(ctx, database.RestoreChirpParams{ID: chirp.ID, UserID: author.ID})
+		assertNoError(t, err)
+		assertNoError(t, repos.RevokedTokens.Revoke(ctx, "token"))
+		assertNoError(t, repos.RevokedTokens.Revoke(ctx, "token"))
+
+		events, err := repos.Events.After(ctx, 0, 100)
+		assertNoError(t, err)
+		want := []database.EventType{
+			database.EventUserCreated,
+			database.EventUserCreated,
+			database.EventChirpCreated,
+			database.EventUserUpdated,
+			database.EventUserUpgradedToRed,
+			database.EventChirpDeleted,
+			database.EventChirpRestored,
+			database.EventTokenRevoked,
+		}
+		if got := eventTypes(events); !slices.Equal(got, want) {
+			t.Fatalf("got: %v\nwant: %v", got, want)
+		}
+		assertOrdered(t, events)
+
+		if user := events[4].User; user == nil || user.ID != author.ID || !user.IsChirpyRed || user.Password != "" {
+			t.Errorf("got user %+v, want the upgraded user without its password", user)
+		}
+		if deleted := events[5].Chirp; deleted == nil || deleted.ID != chirp.ID || deleted.DeletedAt == nil || deleted.Version != 2 {
+			t.Errorf("got chirp %+v, want the deleted chirp at version 2", deleted)
+		}
+		if events[7].Token != "token" {
+			t.Errorf("got token %q, want %q", events[7].Token, "token")
+		}
+	})
+
+	t.Run("after", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+		createChirps(t, repos, author.ID, 4)
+
+		all, err := repos.Events.After(ctx, 0, 100)
+		assertNoError(t, err)
+
+		events, err := repos.Events.After(ctx, all[1].Seq, 2)
+		assertNoError(t, err)
+		if got, want := eventSeqs(events), eventSeqs(all[2:4]); !slices.Equal(got, want) {
+			t.Errorf("got: %v\nwant: %v", got, want)
+		}
+
+		events, err = repos.Events.After(ctx, all[len(all)-1].Seq, 100)
+		assertNoError(t, err)
+		if len(events) != 0 {
+			t.Errorf("got %d events after the last one, want none", len(events))
+		}
+	})
+
+	t.Run("cursors", func(t *testing.T) {
+		repos := factory(t)
+
+		lastSeq, err := repos.Events.LastSeq(ctx)
+		assertNoError(t, err)
+		if lastSeq != 0 {
+			t.Errorf("got last seq %d without events, want 0", lastSeq)
+		}
+
+		assertCursor(t, repos, "indexer", 0)
+		assertNoError(t, repos.Events.SetCursor(ctx, "indexer", 3))
+		assertNoError(t, repos.Events.SetCursor(ctx, "indexer", 5))
+		assertNoError(t, repos.Events.SetCursor(ctx, "notifier", 1))
+		assertCursor(t, repos, "indexer", 5)
+		assertCursor(t, repos, "notifier", 1)
+	})
+
+	t.Run("trim", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+		createChirps(t, repos, author.ID, 2)
+		before, err := repos.Events.After(ctx, 0, 100)
+		assertNoError(t, err)
+
+		trimmed, err := repos.Events.Trim(ctx, time.Now().Add(-time.Hour), before[len(before)-1].Seq)
+		assertNoError(t, err)
+		if trimmed != 0 {
+			t.Errorf("got %d recent events trimmed, want none", trimmed)
+		}
+
+		// Events after maxSeq are kept, however old.
+		trimmed, err = repos.Events.Trim(ctx, time.Now().Add(time.Hour), before[0].Seq)
+		assertNoError(t, err)
+		if trimmed != 1 {
+			t.Errorf("got %d events trimmed up to the first, want 1", trimmed)
+		}
+
+		trimmed, err = repos.Events.Trim(ctx, time.Now().Add(time.Hour), before[len(before)-1].Seq)
+		assertNoError(t, err)
+		if trimmed != len(before)-1 {
+			t.Errorf("got %d events trimmed, want %d", trimmed, len(before)-1)
+		}
+		lastSeq, err := repos.Events.LastSeq(ctx)
+		assertNoError(t, err)
+		if lastSeq != before[len(before)-1].Seq {
+			t.Errorf("got last seq %d once trimmed, want %d", lastSeq, before[len(before)-1].Seq)
+		}
+
+		// Sequence numbers are never reused, or consumers would skip the new events.
+		createChirps(t, repos, author.ID, 1)
+		after, err := repos.Events.After(ctx, 0, 100)
+		assertNoError(t, err)
+		if len(after) != 1 || after[0].Seq <= before[len(before)-1].Seq {
+			t.Errorf("got: %+v\nwant a single event after %d", after, before[len(before)-1].Seq)
+		}
+	})
+
+	t.Run("concurrent changes", func(t *testing.T) {
+		repos := factory(t)
+		author := createUser(t, repos, "author@example.com")
+
+		parallel(t, func(i int) error {
+			_, err := repos.Chirps.Create(ctx, database.CreateChirpParams{Body: fmt.Sprint(i), UserID: author.ID})
+			return err
+		})
+
+		events, err := repos.Events.After(ctx, 0, 100)
+		assertNoError(t, err)
+		if len(events) != concurrency+1 {
+			t.Fatalf("got %d events, want %d", len(events), concurrency+1)
+		}
+		assertOrdered(t, events)
+	})
+}
+
+func createUser(t *testing.T, repos Repositories, email string) database.User {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := repos.Users.Create(ctx, database.CreateUserParams{Email: email, Password: "hash"})
+	assertNoError(t, err)
+	return user
+}
+
+func createChirps(t *testing.T, repos Repositories, userID string, n int) []database.Chirp {
+	t.Helper()
+	ctx := context.Background()
+
+	chirps := make([]database.Chirp, 0, n)
+	for i := 0; i < n; i++ {
+		chirp, err := repos.Chirps.Create(ctx, database.CreateChirpParams{Body: fmt.Sprint("Chirp ", i), UserID: userID})
+		assertNoError(t, err)
+		chirps = append(chirps, chirp)
+	}
+	return chirps
+}
+
+// parallel runs fn concurrency times concurrently and fails t if any of them fails.
+func parallel(t *testing.T, fn func(i int) error) {
+	t.Helper()
+
+	errs := make([]error, concurrency)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assertNoError(t, err)
+	}
+}
+
+func chirpIDs(chirps []database.Chirp) []string {
+	ids := make([]string, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	return ids
+}
+
+// assertChirps checks that got holds the chirps of want, in any order.
+func assertChirps(t *testing.T, got, want []database.Chirp) {
+	t.Helper()
+
+	sortByID := func(chirps []database.Chirp) []database.Chirp {
+		chirps = slices.Clone(chirps)
+		slices.SortFunc(chirps, func(a, b database.Chirp) int {
+			return cmp.Compare(a.ID, b.ID)
+		})
+		return chirps
+	}
+	if !slices.EqualFunc(sortByID(got), sortByID(want), func(a, b database.Chirp) bool { return reflect.DeepEqual(a, b) }) {
+		t.Errorf("got: %+v\nwant: %+v", got, want)
+	}
+}
+
+func assertRevoked(t *testing.T, repos Repositories, token string, want bool) {
+	t.Helper()
+	ctx := context.Background()
+
+	got, err := repos.RevokedTokens.IsRevoked(ctx, token)
+	assertNoError(t, err)
+	if got != want {
+		t.Errorf("token %q revoked: got %t, want %t", token, got, want)
+	}
+}
+
+func eventTypes(events []database.Event) []database.EventType {
+	types := make([]database.EventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func eventSeqs(events []database.Event) []int64 {
+	seqs := make([]int64, 0, len(events))
+	for _, event := range events {
+		seqs = append(seqs, event.Seq)
+	}
+	return seqs
+}
+
+// assertOrdered checks that the sequence numbers of events are strictly increasing.
+func assertOrdered(t *testing.T, events []database.Event) {
+	t.Helper()
+
+	for i := 1; i < len(events); i++ {
+		if events[i].Seq <= events[i-1].Seq {
+			t.Fatalf("event %d has seq %d after %d", i, events[i].Seq, events[i-1].Seq)
+		}
+	}
+}
+
+func assertCursor(t *testing.T, repos Repositories, consumer string, want int64) {
+	t.Helper()
+	ctx := context.Background()
+
+	got, err := repos.Events.Cursor(ctx, consumer)
+	assertNoError(t, err)
+	if got != want {
+		t.Errorf("cursor of %q: got %d, want %d", consumer, got, want)
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %q", err)
+	}
+}
+
+func assertError(t *testing.T, got, want error) {
+	t.Helper()
+
+	if got != want {
+		t.Fatalf("got: %v\nwant: %s", got, want)
+	}
+}
+
+func assertCanceled(t *testing.T, err error) {
+	t.Helper()
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got: %v\nwant: %s", err, context.Canceled)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
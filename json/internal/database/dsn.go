@@ -0,0 +1,38 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Supported storage backends, selected by the scheme of the DSN.
+const (
+	DriverJSON   = "json"
+	DriverSQLite = "sqlite"
+	DriverMemory = "memory"
+)
+
+// ParseDSN splits a DSN into the storage driver and the path it refers to.
+// A DSN of the form sqlite:///var/lib/chirpy.db selects SQLite, a plain path selects the JSON file database
+// and memory:// selects a database that only lives in memory.
+func ParseDSN(dsn string) (driver, path string, err error) {
+	scheme, rest, ok := strings.Cut(dsn, "://")
+	if !ok {
+		return DriverJSON, dsn, nil
+	}
+
+	switch scheme {
+	case DriverSQLite:
+		if rest == "" {
+			return "", "", fmt.Errorf("missing path in DSN %q", dsn)
+		}
+		return DriverSQLite, rest, nil
+	case DriverMemory:
+		if rest != "" {
+			return "", "", fmt.Errorf("unexpected path in DSN %q", dsn)
+		}
+		return DriverMemory, "", nil
+	default:
+		return "", "", fmt.Errorf("unsupported DSN scheme %q", scheme)
+	}
+}
@@ -0,0 +1,36 @@
+package database
+
+import "testing"
+
+func TestParseDSN(t *testing.T) {
+	cases := []struct {
+		Desc   string
+		DSN    string
+		Driver string
+		Path   string
+	}{
+		{Desc: "plain path", DSN: "database.json", Driver: DriverJSON, Path: "database.json"},
+		{Desc: "sqlite absolute path", DSN: "sqlite:///var/lib/chirpy.db", Driver: DriverSQLite, Path: "/var/lib/chirpy.db"},
+		{Desc: "sqlite relative path", DSN: "sqlite://chirpy.db", Driver: DriverSQLite, Path: "chirpy.db"},
+		{Desc: "memory", DSN: "memory://", Driver: DriverMemory, Path: ""},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.Desc, func(t *testing.T) {
+			driver, path, err := ParseDSN(cs.DSN)
+			if err != nil {
+				t.Fatalf("Unexpected error : %q", err)
+			}
+			if driver != cs.Driver || path != cs.Path {
+				t.Errorf("\ngot: %q %q\nwant: %q %q", driver, path, cs.Driver, cs.Path)
+			}
+		})
+	}
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		_, _, err := ParseDSN("postgres://localhost/chirpy")
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the size in bytes of the keys that encrypt the database, which selects AES-256.
+const KeySize = 32
+
+// envelopeAlgorithm identifies the encryption scheme of an envelope.
+const envelopeAlgorithm = "aes-256-gcm"
+
+// ErrWrongKey is returned when the database is encrypted with a key that is not configured.
+// Unlike ErrCorrupt it never causes the file to be moved aside: the data is fine, the configuration is not.
+var ErrWrongKey = errors.New("database is encrypted with a key that is not configured")
+
+// A Keyring holds the keys that encrypt the database file and its write-ahead log.
+//
+// Data is written with envelope encryption: every write is encrypted with a fresh random data key,
+// and the data key is encrypted with the primary key and stored next to the data.
+// Previous keys are only used to decrypt, so that files written before a key rotation can still be read;
+// they are re-encrypted with the primary key when the database is opened.
+// A Keyring without a primary key writes plaintext, which decrypts a database for good.
+type Keyring struct {
+	primary *key
+	byID    map[string]*key
+}
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// envelope is the encoding of encrypted data.
+type envelope struct {
+	Encryption string `json:"encryption"`
+	KeyID      string `json:"key_id"`
+	// DataKey is the data key, encrypted with the key identified by KeyID.
+	DataKey []byte `json:"data_key"`
+	// Ciphertext is the data, encrypted with the data key.
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// NewKeyring returns a Keyring that encrypts with primary and decrypts with primary or any of the previous keys.
+// primary may be nil to stop encrypting. NewKeyring returns nil when no key is given at all.
+func NewKeyring(primary []byte, previous ...[]byte) (*Keyring, error) {
+	if primary == nil && len(previous) == 0 {
+		return nil, nil
+	}
+
+	keys := &Keyring{byID: make(map[string]*key)}
+	for i, raw := range append([][]byte{primary}, previous...) {
+		if raw == nil {
+			continue
+		}
+
+		k, err := newKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			keys.primary = k
+		}
+		if _, ok := keys.byID[k.id]; !ok {
+			keys.byID[k.id] = k
+		}
+	}
+	return keys, nil
+}
+
+func newKey(raw []byte) (*key, error) {
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(raw)
+	return &key{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func newAEAD(raw []byte) (cipher.AEAD, error) {
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(raw))
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a new data key wrapped by the primary key.
+// Without a primary key plaintext is returned as is.
+func (keys *Keyring) seal(plaintext []byte) ([]byte, error) {
+	if keys == nil || keys.primary == nil {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, KeySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := encrypt(keys.primary.aead, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := encrypt(aead, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(envelope{
+		Encryption: envelopeAlgorithm,
+		KeyID:      keys.primary.id,
+		DataKey:    wrappedKey,
+		Ciphertext: ciphertext,
+	})
+}
+
+// open decrypts data written by seal. Data that is not an envelope is returned as is.
+// stale reports whether data is not written the way seal would write it now,
+// because it is plaintext or because it is encrypted with a previous key.
+func (keys *Keyring) open(data []byte) (plaintext []byte, stale bool, err error) {
+	e := envelope{}
+	if json.Unmarshal(data, &e) != nil || e.Encryption == "" {
+		return data, keys != nil && keys.primary != nil, nil
+	}
+
+	if e.Encryption != envelopeAlgorithm {
+		return nil, false, fmt.Errorf("unsupported encryption %q", e.Encryption)
+	}
+	if keys == nil {
+		return nil, false, fmt.Errorf("%w : no key is configured", ErrWrongKey)
+	}
+	k, ok := keys.byID[e.KeyID]
+	if !ok {
+		return nil, false, fmt.Errorf("%w : key %s", ErrWrongKey, e.KeyID)
+	}
+
+	dataKey, err := decrypt(k.aead, e.DataKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w : failed to decrypt the data key : %s", ErrCorrupt, err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w : %s", ErrCorrupt, err)
+	}
+	plaintext, err = decrypt(aead, e.Ciphertext)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w : failed to decrypt : %s", ErrCorrupt, err)
+	}
+	return plaintext, keys.primary != k, nil
+}
+
+// encrypt returns the nonce followed by the ciphertext of plaintext.
+func encrypt(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	// The data key is random and used for a single message, so the nonce can never repeat under it;
+	// the primary key wraps many data keys and relies on the 96 bit random nonce.
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedDatabase(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+
+	for _, test := range []struct {
+		Desc    string
+		Options Options
+	}{
+		{Desc: "snapshot", Options: Options{}},
+		{Desc: "write-ahead log", Options: Options{WAL: true}},
+	} {
+		t.Run(test.Desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "database.json")
+			test.Options.Keys = newTestKeyring(t, key)
+
+			db, err := New(path, test.Options)
+			assertNoError(t, err)
+			putUsers(t, db, 2)
+			if test.Options.WAL {
+				crash(t, db)
+			} else {
+				assertNoError(t, db.Close())
+			}
+
+			for _, file := range []string{path, path + walSuffix} {
+				data, err := os.ReadFile(file)
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				assertNoError(t, err)
+				if bytes.Contains(data, []byte("user1@example.com")) {
+					t.Errorf("%s holds plaintext", filepath.Base(file))
+				}
+
+				info, err := os.Stat(file)
+				assertNoError(t, err)
+				if mode := info.Mode().Perm(); mode != fileMode {
+					t.Errorf("%s has mode %v, want %v", filepath.Base(file), mode, fileMode)
+				}
+			}
+
+			db, err = New(path, test.Options)
+			assertNoError(t, err)
+			assertUsers(t, db, 2)
+			assertNoError(t, db.Close())
+		})
+	}
+}
+
+func TestEncryptedDatabaseWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := New(path, Options{Keys: newTestKeyring(t, bytes.Repeat([]byte{1}, KeySize))})
+	assertNoError(t, err)
+	putUsers(t, db, 1)
+	assertNoError(t, db.Close())
+	before, err := os.ReadFile(path)
+	assertNoError(t, err)
+
+	for _, test := range []struct {
+		Desc string
+		Keys *Keyring
+	}{
+		{Desc: "no key", Keys: nil},
+		{Desc: "other key", Keys: newTestKeyring(t, bytes.Repeat([]byte{2}, KeySize))},
+	} {
+		t.Run(test.Desc, func(t *testing.T) {
+			_, err := New(path, Options{Keys: test.Keys, Recover: true})
+			if !errors.Is(err, ErrWrongKey) {
+				t.Fatalf("got %v, want %v", err, ErrWrongKey)
+			}
+
+			after, err := os.ReadFile(path)
+			assertNoError(t, err)
+			if !bytes.Equal(before, after) {
+				t.Error("the database file was changed")
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, KeySize)
+	newKey := bytes.Repeat([]byte{2}, KeySize)
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	// Plaintext, then encrypted with the old key, then with the new one, then plaintext again.
+	steps := []*Keyring{
+		nil,
+		newTestKeyring(t, oldKey),
+		newTestKeyring(t, newKey, oldKey),
+		newTestKeyring(t, newKey),
+		newTestKeyring(t, nil, newKey),
+		nil,
+	}
+	for i, keys := range steps {
+		db, err := New(path, Options{Keys: keys})
+		assertNoError(t, err)
+		if i == 0 {
+			putUsers(t, db, 1)
+		}
+		assertUsers(t, db, 1)
+		assertNoError(t, db.Close())
+	}
+}
+
+func newTestKeyring(t testing.TB, primary []byte, previous ...[]byte) *Keyring {
+	t.Helper()
+
+	keys, err := NewKeyring(primary, previous...)
+	assertNoError(t, err)
+	return keys
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// EventType identifies the change an Event describes.
+type EventType string
+
+const (
+	EventChirpCreated      EventType = "chirp_created"
+	EventChirpDeleted      EventType = "chirp_deleted"
+	EventChirpRestored     EventType = "chirp_restored"
+	EventUserCreated       EventType = "user_created"
+	EventUserUpdated       EventType = "user_updated"
+	EventUserUpgradedToRed EventType = "user_upgraded_to_red"
+	EventTokenRevoked      EventType = "token_revoked"
+	EventUserFollowed      EventType = "user_followed"
+	EventUserUnfollowed    EventType = "user_unfollowed"
+)
+
+// An Event describes a change made to the database. Repositories store it in the same transaction as the change,
+// so every committed change has exactly one event and events are numbered in the order the changes were committed.
+type Event struct {
+	// Seq is the position of the event in the stream. It starts at 1 and is never reused.
+	Seq  int64     `json:"seq"`
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Chirp is the chirp after the change, for chirp events.
+	Chirp *Chirp `json:"chirp,omitempty"`
+	// User is the user after the change, without its password, for user events.
+	User *User `json:"user,omitempty"`
+	// Token is the revoked refresh token, for TokenRevoked.
+	Token string `json:"token,omitempty"`
+	// Follow is the follow that started or ended, for UserFollowed and UserUnfollowed.
+	Follow *Follow `json:"follow,omitempty"`
+}
+
+// NewChirpEvent returns an event of type t about chirp.
+func NewChirpEvent(t EventType, chirp Chirp) Event {
+	return Event{Type: t, Time: time.Now().UTC(), Chirp: &chirp}
+}
+
+// NewUserEvent returns an event of type t about user. The password is left out.
+func NewUserEvent(t EventType, user User) Event {
+	user.Password = ""
+	return Event{Type: t, Time: time.Now().UTC(), User: &user}
+}
+
+// NewTokenRevokedEvent returns the event of the revocation of token.
+func NewTokenRevokedEvent(token string) Event {
+	return Event{Type: EventTokenRevoked, Time: time.Now().UTC(), Token: token}
+}
+
+// NewFollowEvent returns an event of type t about follow.
+func NewFollowEvent(t EventType, follow Follow) Event {
+	return Event{Type: t, Time: time.Now().UTC(), Follow: &follow}
+}
+
+// EventRepository reads the events the other repositories store and keeps track of how far each consumer got.
+type EventRepository interface {
+	// After returns, in order, up to limit events with a Seq greater than seq.
+	After(ctx context.Context, seq int64, limit int) ([]Event, error)
+	// LastSeq returns the Seq of the last event stored, even if it was trimmed since, or 0 if there is none.
+	LastSeq(ctx context.Context) (int64, error)
+	// Cursor returns the Seq of the last event consumer has processed, or 0 if it has not processed any.
+	Cursor(ctx context.Context, consumer string) (int64, error)
+	SetCursor(ctx context.Context, consumer string, seq int64) error
+	// Trim removes the events that happened before before and have a Seq up to maxSeq,
+	// and returns how many it removed.
+	Trim(ctx context.Context, before time.Time, maxSeq int64) (int, error)
+}
@@ -0,0 +1,21 @@
+package database
+
+import "context"
+
+// A Follow is a user following another one.
+type Follow struct {
+	FollowerID string `json:"follower_id"`
+	FolloweeID string `json:"followee_id"`
+}
+
+// FollowRepository stores who follows whom.
+type FollowRepository interface {
+	// Follow makes follow.FollowerID follow follow.FolloweeID. Following a user again changes nothing.
+	// It fails with ErrUserNotFound if either user does not exist.
+	Follow(ctx context.Context, follow Follow) error
+	// Unfollow stops follow.FollowerID from following follow.FolloweeID. Unfollowing a user that is not followed
+	// changes nothing.
+	Unfollow(ctx context.Context, follow Follow) error
+	// CountFollowers returns how many users follow the user with the given ID.
+	CountFollowers(ctx context.Context, userID string) (int, error)
+}
@@ -0,0 +1,344 @@
+package database
+
+import "slices"
+
+// Secondary indexes let lookups by something other than the primary key avoid scanning a whole collection.
+// They live in unexported fields of DBStructure, are rebuilt when a file is loaded
+// and are kept consistent by setChirp, removeChirp, setUser, removeUser, setFollow and removeFollow,
+// which every change goes through.
+// Chirps and users are indexed by sorted lists of IDs: IDs sort by creation time, so a page is a binary search and a walk.
+
+// indexes groups the secondary indexes of a DBStructure.
+type indexes struct {
+	// usersByEmail maps an email to the ID of the user that owns it.
+	usersByEmail map[string]string
+	// usersByHandle maps a handle to the ID of the user that has it.
+	usersByHandle map[string]string
+	// usersByPreviousHandle maps a previous handle to the IDs of the users that had it.
+	usersByPreviousHandle map[string]map[string]struct{}
+	// userIDs are the IDs of every user, sorted.
+	userIDs []string
+	// followers maps a user ID to the IDs of the users who follow them.
+	followers map[string]map[string]struct{}
+	// chirpIDs are the IDs of every chirp, sorted.
+	chirpIDs []string
+	// chirpsByAuthor maps a user ID to the sorted IDs of the chirps they wrote.
+	chirpsByAuthor map[string][]string
+	// chirpsByHashtag maps a hashtag to the sorted IDs of the chirps tagged with it.
+	chirpsByHashtag map[string][]string
+	// chirpsByMention maps a user ID to the sorted IDs of the chirps that mention them.
+	chirpsByMention map[string][]string
+}
+
+// buildIndexes rebuilds every secondary index from the collections.
+func (dbs *DBStructure) buildIndexes() {
+	dbs.indexes = indexes{
+		usersByEmail:          make(map[string]string, len(dbs.Users)),
+		usersByHandle:         make(map[string]string),
+		usersByPreviousHandle: make(map[string]map[string]struct{}),
+		userIDs:               make([]string, 0, len(dbs.Users)),
+		followers:             make(map[string]map[string]struct{}),
+		chirpIDs:              make([]string, 0, len(dbs.Chirps)),
+		chirpsByAuthor:        make(map[string][]string),
+		chirpsByHashtag:       make(map[string][]string),
+		chirpsByMention:       make(map[string][]string),
+	}
+
+	for _, user := range dbs.Users {
+		dbs.indexUser(user)
+		dbs.indexes.userIDs = append(dbs.indexes.userIDs, user.ID)
+	}
+	slices.Sort(dbs.indexes.userIDs)
+	for followerID, followeeIDs := range dbs.Follows {
+		for followeeID := range followeeIDs {
+			index(dbs.indexes.followers, followeeID, followerID)
+		}
+	}
+	// Inserting the IDs one by one in map order would shift the lists on every insert: sort them once instead.
+	for _, chirp := range dbs.Chirps {
+		dbs.indexes.chirpIDs = append(dbs.indexes.chirpIDs, chirp.ID)
+		dbs.indexes.chirpsByAuthor[chirp.UserID] = append(dbs.indexes.chirpsByAuthor[chirp.UserID], chirp.ID)
+		for _, hashtag := range chirp.Hashtags {
+			dbs.indexes.chirpsByHashtag[hashtag] = append(dbs.indexes.chirpsByHashtag[hashtag], chirp.ID)
+		}
+		for _, userID := range mentionedUserIDs(chirp) {
+			dbs.indexes.chirpsByMention[userID] = append(dbs.indexes.chirpsByMention[userID], chirp.ID)
+		}
+	}
+	slices.Sort(dbs.indexes.chirpIDs)
+	lists := []map[string][]string{dbs.indexes.chirpsByAuthor, dbs.indexes.chirpsByHashtag, dbs.indexes.chirpsByMention}
+	for _, lists := range lists {
+		for _, ids := range lists {
+			slices.Sort(ids)
+		}
+	}
+}
+
+// UserByEmail returns the user that owns email.
+func (dbs *DBStructure) UserByEmail(email string) (User, bool) {
+	userID, ok := dbs.indexes.usersByEmail[email]
+	if !ok {
+		return User{}, false
+	}
+	return dbs.Users[userID], true
+}
+
+// UserByHandle returns the user whose handle is handle.
+func (dbs *DBStructure) UserByHandle(handle string) (User, bool) {
+	userID, ok := dbs.indexes.usersByHandle[handle]
+	if !ok {
+		return User{}, false
+	}
+	return dbs.Users[userID], true
+}
+
+// UserByPreviousHandle returns the user who changed from handle most recently.
+func (dbs *DBStructure) UserByPreviousHandle(handle string) (User, bool) {
+	var latest User
+	for userID := range dbs.indexes.usersByPreviousHandle[handle] {
+		user := dbs.Users[userID]
+		if latest.ID == "" || user.HandleChangedAt.After(*latest.HandleChangedAt) ||
+			(user.HandleChangedAt.Equal(*latest.HandleChangedAt) && user.ID > latest.ID) {
+			latest = user
+		}
+	}
+	return latest, latest.ID != ""
+}
+
+// FollowerCount returns how many users follow the user with the given ID.
+func (dbs *DBStructure) FollowerCount(userID string) int {
+	return len(dbs.indexes.followers[userID])
+}
+
+// ListUsers returns a page of at most params.Limit users.
+func (dbs *DBStructure) ListUsers(params ListUsersParams) []User {
+	ids := dbs.indexes.userIDs
+	i := 0
+	if params.After != "" {
+		next, found := slices.BinarySearch(ids, params.After)
+		i = next
+		if found {
+			i++
+		}
+	}
+
+	users := []User{}
+	for ; i < len(ids) && len(users) < params.Limit; i++ {
+		users = append(users, dbs.Users[ids[i]])
+	}
+	return users
+}
+
+// ChirpsByAuthor returns the chirps written by the user with the given ID, sorted by ID.
+func (dbs *DBStructure) ChirpsByAuthor(userID string) []Chirp {
+	return dbs.chirps(dbs.indexes.chirpsByAuthor[userID])
+}
+
+// ChirpsByHashtag returns the chirps tagged with hashtag, sorted by ID.
+func (dbs *DBStructure) ChirpsByHashtag(hashtag string) []Chirp {
+	return dbs.chirps(dbs.indexes.chirpsByHashtag[hashtag])
+}
+
+func (dbs *DBStructure) chirps(chirpIDs []string) []Chirp {
+	chirps := make([]Chirp, 0, len(chirpIDs))
+	for _, chirpID := range chirpIDs {
+		chirps = append(chirps, dbs.Chirps[chirpID])
+	}
+	return chirps
+}
+
+// ListChirps returns a page of at most params.Limit chirps that are not deleted.
+// It walks the sorted IDs of the narrowest index from the cursor,
+// so it costs as much as the page and the deleted chirps it skips, whatever the number of chirps.
+func (dbs *DBStructure) ListChirps(params ListChirpsParams) []Chirp {
+	ids := dbs.indexes.chirpIDs
+	switch {
+	case params.Hashtag != "":
+		ids = dbs.indexes.chirpsByHashtag[params.Hashtag]
+	case params.MentionedUserID != "":
+		ids = dbs.indexes.chirpsByMention[params.MentionedUserID]
+	case params.AuthorID != "":
+		ids = dbs.indexes.chirpsByAuthor[params.AuthorID]
+	}
+	matches := func(chirp Chirp) bool {
+		switch {
+		case chirp.DeletedAt != nil:
+			return false
+		case params.AuthorID != "" && chirp.UserID != params.AuthorID:
+			return false
+		case params.MentionedUserID != "" && !slices.Contains(mentionedUserIDs(chirp), params.MentionedUserID):
+			return false
+		default:
+			return true
+		}
+	}
+
+	i, step := 0, 1
+	if params.Desc {
+		i, step = len(ids)-1, -1
+	}
+	if params.After != "" {
+		// next is the position of the first ID greater than or equal to the cursor.
+		next, found := slices.BinarySearch(ids, params.After)
+		switch {
+		case params.Desc:
+			i = next - 1
+		case found:
+			i = next + 1
+		default:
+			i = next
+		}
+	}
+
+	chirps := []Chirp{}
+	for ; i >= 0 && i < len(ids) && len(chirps) < params.Limit; i += step {
+		if chirp := dbs.Chirps[ids[i]]; matches(chirp) {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return chirps
+}
+
+func (dbs *DBStructure) setChirp(chirp Chirp) {
+	dbs.removeChirp(chirp.ID)
+	dbs.Chirps[chirp.ID] = chirp
+	dbs.indexChirp(chirp)
+}
+
+func (dbs *DBStructure) removeChirp(id string) {
+	old, ok := dbs.Chirps[id]
+	if !ok {
+		return
+	}
+
+	delete(dbs.Chirps, id)
+	dbs.indexes.chirpIDs = removeSorted(dbs.indexes.chirpIDs, id)
+	unindexSorted(dbs.indexes.chirpsByAuthor, old.UserID, id)
+	for _, hashtag := range old.Hashtags {
+		unindexSorted(dbs.indexes.chirpsByHashtag, hashtag, id)
+	}
+	for _, userID := range mentionedUserIDs(old) {
+		unindexSorted(dbs.indexes.chirpsByMention, userID, id)
+	}
+}
+
+func (dbs *DBStructure) indexChirp(chirp Chirp) {
+	dbs.indexes.chirpIDs = insertSorted(dbs.indexes.chirpIDs, chirp.ID)
+	indexSorted(dbs.indexes.chirpsByAuthor, chirp.UserID, chirp.ID)
+	for _, hashtag := range chirp.Hashtags {
+		indexSorted(dbs.indexes.chirpsByHashtag, hashtag, chirp.ID)
+	}
+	for _, userID := range mentionedUserIDs(chirp) {
+		indexSorted(dbs.indexes.chirpsByMention, userID, chirp.ID)
+	}
+}
+
+// mentionedUserIDs returns the IDs of the users chirp mentions, without duplicates.
+func mentionedUserIDs(chirp Chirp) []string {
+	var userIDs []string
+	for _, mention := range chirp.Mentions {
+		if !slices.Contains(userIDs, mention.UserID) {
+			userIDs = append(userIDs, mention.UserID)
+		}
+	}
+	return userIDs
+}
+
+// insertSorted adds id to the sorted ids. New chirps and users have the greatest IDs, so it usually appends.
+func insertSorted(ids []string, id string) []string {
+	i, found := slices.BinarySearch(ids, id)
+	if found {
+		return ids
+	}
+	return slices.Insert(ids, i, id)
+}
+
+// removeSorted removes id from the sorted ids.
+func removeSorted(ids []string, id string) []string {
+	i, found := slices.BinarySearch(ids, id)
+	if !found {
+		return ids
+	}
+	return slices.Delete(ids, i, i+1)
+}
+
+// indexSorted adds id to the sorted list of IDs under key.
+func indexSorted(lists map[string][]string, key, id string) {
+	lists[key] = insertSorted(lists[key], id)
+}
+
+// unindexSorted removes id from the sorted list of IDs under key, and the list once it is empty.
+func unindexSorted(lists map[string][]string, key, id string) {
+	ids := removeSorted(lists[key], id)
+	if len(ids) == 0 {
+		delete(lists, key)
+		return
+	}
+	lists[key] = ids
+}
+
+// index adds id to the set of IDs under key.
+func index(sets map[string]map[string]struct{}, key, id string) {
+	ids, ok := sets[key]
+	if !ok {
+		ids = make(map[string]struct{})
+		sets[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+// unindex removes id from the set of IDs under key, and the set once it is empty.
+func unindex(sets map[string]map[string]struct{}, key, id string) {
+	delete(sets[key], id)
+	if len(sets[key]) == 0 {
+		delete(sets, key)
+	}
+}
+
+func (dbs *DBStructure) setUser(user User) {
+	dbs.removeUser(user.ID)
+	dbs.Users[user.ID] = user
+	dbs.indexes.userIDs = insertSorted(dbs.indexes.userIDs, user.ID)
+	dbs.indexUser(user)
+}
+
+func (dbs *DBStructure) removeUser(id string) {
+	old, ok := dbs.Users[id]
+	if !ok {
+		return
+	}
+
+	delete(dbs.Users, id)
+	dbs.indexes.userIDs = removeSorted(dbs.indexes.userIDs, id)
+	if dbs.indexes.usersByEmail[old.Email] == id {
+		delete(dbs.indexes.usersByEmail, old.Email)
+	}
+	if old.Handle != "" && dbs.indexes.usersByHandle[old.Handle] == id {
+		delete(dbs.indexes.usersByHandle, old.Handle)
+	}
+	if old.PreviousHandle != "" {
+		unindex(dbs.indexes.usersByPreviousHandle, old.PreviousHandle, id)
+	}
+}
+
+func (dbs *DBStructure) indexUser(user User) {
+	if _, taken := dbs.indexes.usersByEmail[user.Email]; !taken {
+		dbs.indexes.usersByEmail[user.Email] = user.ID
+	}
+	if _, taken := dbs.indexes.usersByHandle[user.Handle]; user.Handle != "" && !taken {
+		dbs.indexes.usersByHandle[user.Handle] = user.ID
+	}
+	if user.PreviousHandle != "" {
+		index(dbs.indexes.usersByPreviousHandle, user.PreviousHandle, user.ID)
+	}
+}
+
+func (dbs *DBStructure) setFollow(follow Follow) {
+	index(dbs.Follows, follow.FollowerID, follow.FolloweeID)
+	index(dbs.indexes.followers, follow.FolloweeID, follow.FollowerID)
+}
+
+func (dbs *DBStructure) removeFollow(follow Follow) {
+	unindex(dbs.Follows, follow.FollowerID, follow.FolloweeID)
+	unindex(dbs.indexes.followers, follow.FolloweeID, follow.FollowerID)
+}
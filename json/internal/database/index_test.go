@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestIndexesStayConsistent(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "database.json"), Options{})
+	assertNoError(t, err)
+
+	err = db.Update(context.Background(), func(dbs *DBStructure) error {
+		dbs.PutUser(User{ID: "u1", Email: "old@example.com"})
+		dbs.PutChirp(Chirp{ID: "c1", UserID: "u1"})
+		dbs.PutChirp(Chirp{ID: "c2", UserID: "u1"})
+		return nil
+	})
+	assertNoError(t, err)
+
+	err = db.Update(context.Background(), func(dbs *DBStructure) error {
+		dbs.PutUser(User{ID: "u1", Email: "new@example.com"})
+		dbs.DeleteChirp("c1")
+		return nil
+	})
+	assertNoError(t, err)
+
+	// A rolled back update must not leave stale index entries behind.
+	errAbort := errors.New("abort")
+	err = db.Update(context.Background(), func(dbs *DBStructure) error {
+		dbs.PutUser(User{ID: "u1", Email: "rolled-back@example.com"})
+		dbs.PutChirp(Chirp{ID: "c3", UserID: "u1"})
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("got: %v\nwant: %v", err, errAbort)
+	}
+
+	db.View(context.Background(), func(dbs *DBStructure) error {
+		if _, ok := dbs.UserByEmail("old@example.com"); ok {
+			t.Error("found a user by their previous email")
+		}
+		if _, ok := dbs.UserByEmail("rolled-back@example.com"); ok {
+			t.Error("found a user by a rolled back email")
+		}
+		if user, ok := dbs.UserByEmail("new@example.com"); !ok || user.ID != "u1" {
+			t.Errorf("got %+v, want user u1", user)
+		}
+
+		chirps := dbs.ChirpsByAuthor("u1")
+		if len(chirps) != 1 || chirps[0].ID != "c2" {
+			t.Errorf("got chirps %+v, want only c2", chirps)
+		}
+		return nil
+	})
+}
+
+func TestListChirpsFromAMissingCursor(t *testing.T) {
+	dbs := NewDBStructure()
+	deletedAt := time.Now()
+	for _, chirp := range []Chirp{{ID: "c1"}, {ID: "c3"}, {ID: "c4", DeletedAt: &deletedAt}, {ID: "c5"}} {
+		dbs.setChirp(chirp)
+	}
+
+	// The cursor may be a chirp that has been purged since the previous page.
+	cases := []struct {
+		Desc   string
+		Params ListChirpsParams
+		Want   []string
+	}{
+		{Desc: "ascending", Params: ListChirpsParams{After: "c2", Limit: 10}, Want: []string{"c3", "c5"}},
+		{Desc: "descending", Params: ListChirpsParams{After: "c2", Desc: true, Limit: 10}, Want: []string{"c1"}},
+		{Desc: "limited", Params: ListChirpsParams{After: "c0", Limit: 2}, Want: []string{"c1", "c3"}},
+		{Desc: "past the end", Params: ListChirpsParams{After: "c9", Limit: 10}, Want: []string{}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.Desc, func(t *testing.T) {
+			got := []string{}
+			for _, chirp := range dbs.ListChirps(cs.Params) {
+				got = append(got, chirp.ID)
+			}
+			if !slices.Equal(got, cs.Want) {
+				t.Errorf("\ngot: %v\nwant: %v", got, cs.Want)
+			}
+		})
+	}
+}
+
+func BenchmarkUserByEmail(b *testing.B) {
+	for _, n := range []int{1_000, 10_000, 100_000} {
+		dbs := benchmarkDBStructure(n)
+		email := fmt.Sprintf("user%d@example.com", n/2)
+
+		b.Run(fmt.Sprintf("%d users", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dbs.UserByEmail(email)
+			}
+		})
+	}
+}
+
+func BenchmarkChirpsByAuthor(b *testing.B) {
+	for _, n := range []int{1_000, 10_000, 100_000} {
+		dbs := benchmarkDBStructure(n)
+		userID := fmt.Sprint(n / 2)
+
+		b.Run(fmt.Sprintf("%d chirps", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dbs.ChirpsByAuthor(userID)
+			}
+		})
+	}
+}
+
+func BenchmarkListChirps(b *testing.B) {
+	for _, n := range []int{1_000, 10_000, 100_000} {
+		dbs := benchmarkDBStructure(n)
+		after := fmt.Sprint("c", n/2)
+
+		b.Run(fmt.Sprintf("%d chirps", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dbs.ListChirps(ListChirpsParams{After: after, Limit: 20})
+			}
+		})
+	}
+}
+
+// benchmarkDBStructure returns n users with one chirp each.
+func benchmarkDBStructure(n int) DBStructure {
+	dbs := NewDBStructure()
+	for i := 0; i < n; i++ {
+		userID := fmt.Sprint(i)
+		dbs.setUser(User{ID: userID, Email: fmt.Sprintf("user%d@example.com", i)})
+		dbs.setChirp(Chirp{ID: "c" + userID, UserID: userID})
+	}
+	return dbs
+}
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zoumas/chirpy/json/internal/hashtag"
+	"github.com/zoumas/chirpy/json/internal/id"
+)
+
+// A Migration upgrades a database file from Version-1 to Version.
+// It works on the generic JSON document, since older files may not decode into the current DBStructure.
+// Numbers in the document are json.Number.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(doc map[string]any) error
+}
+
+// migrations is the ordered registry of the migrations of the JSON database.
+// Files without a version field are at version 0.
+// Migrations are append-only: never edit one that has already been released.
+var migrations = []Migration{
+	{Version: 1, Description: "replace integer IDs with ULIDs", Up: migrateToULIDs},
+	{Version: 2, Description: "normalize emails", Up: migrateNormalizeEmails},
+	{Version: 3, Description: "version chirps and users", Up: migrateVersionEntities},
+	{Version: 4, Description: "extract hashtags", Up: migrateHashtags},
+	{Version: 5, Description: "add follows", Up: migrateFollows},
+}
+
+// CurrentVersion is the schema version of the files this server writes.
+var CurrentVersion = len(migrations)
+
+// decode unmarshals a database file, upgrading it first if it was written by an older version.
+// It returns the migrations that were applied.
+func decode(data []byte) (DBStructure, []Migration, error) {
+	probe := struct {
+		Version int `json:"version"`
+	}{}
+	err := json.Unmarshal(data, &probe)
+	if err != nil {
+		return DBStructure{}, nil, err
+	}
+
+	switch {
+	case probe.Version > CurrentVersion:
+		return DBStructure{}, nil, fmt.Errorf(
+			"database version %d is newer than this server supports (%d)",
+			probe.Version,
+			CurrentVersion,
+		)
+	case probe.Version == CurrentVersion:
+		dbs := DBStructure{}
+		err = json.Unmarshal(data, &dbs)
+		return dbs, nil, err
+	}
+
+	doc := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&doc)
+	if err != nil {
+		return DBStructure{}, nil, err
+	}
+
+	pending := migrations[probe.Version:]
+	for _, migration := range pending {
+		err := migration.Up(doc)
+		if err != nil {
+			return DBStructure{}, nil, fmt.Errorf("migration %d (%s) : %w", migration.Version, migration.Description, err)
+		}
+	}
+	doc["version"] = CurrentVersion
+
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return DBStructure{}, nil, err
+	}
+
+	dbs := DBStructure{}
+	err = json.Unmarshal(data, &dbs)
+	return dbs, pending, err
+}
+
+// Migrate upgrades the database file at path to CurrentVersion and returns the migrations it applied.
+// The write-ahead log, if any, is folded into the migrated file and removed. Its entries must have been written
+// with CurrentVersion, otherwise Migrate fails with ErrWALVersion and changes nothing.
+// The original file and log are copied next to backupPath before they are rewritten.
+// With dryRun set the files are left untouched and the migrations that would run are returned.
+// keys decrypt the files and encrypt the migrated one; the backup is a copy of the originals, encrypted or not.
+func Migrate(path string, keys *Keyring, dryRun bool) (applied []Migration, backupPath string, err error) {
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, _, err := keys.open(original)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dbs, applied, err := decode(data)
+	if errors.Is(err, ErrEmailCollision) {
+		return nil, "", err
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w : %s", ErrCorrupt, err)
+	}
+	err = dbs.Validate()
+	if err != nil {
+		return nil, "", fmt.Errorf("%w : %s", ErrCorrupt, err)
+	}
+
+	if len(applied) == 0 {
+		return nil, "", nil
+	}
+
+	entries, _, err := replayWALs(path, &dbs, keys)
+	if errors.Is(err, ErrWALVersion) {
+		return nil, "", fmt.Errorf("%w (start the server that wrote it and stop it cleanly to compact it)", err)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if dryRun {
+		return applied, "", nil
+	}
+
+	backupPath = fmt.Sprintf("%s.backup-v%d-%d", path, CurrentVersion-len(applied), time.Now().Unix())
+	err = writeFileAtomic(backupPath, original, fileMode)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, suffix := range []string{walSuffix, walSuffix + rotatedSuffix} {
+		err = copyFile(path+suffix, backupPath+suffix)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	db := &DB{path: path, keys: keys}
+	err = db.persist(dbs)
+	if err != nil {
+		return nil, "", err
+	}
+	if entries > 0 {
+		log.Printf("folded %d write-ahead log entries into %s", entries, path)
+	}
+	err = removeWAL(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return applied, backupPath, nil
+}
+
+// copyFile atomically copies the file at src to dst. A missing src is not an error.
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, data, fileMode)
+}
+
+// migrateToULIDs replaces every integer ID n of chirps and users with id.Legacy(n).
+// Files written between the switch to ULIDs and the introduction of versions already hold ULIDs, which are kept.
+func migrateToULIDs(doc map[string]any) error {
+	for _, collection := range []string{"chirps", "users"} {
+		if doc[collection] == nil {
+			continue
+		}
+		entities, ok := doc[collection].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is not an object", collection)
+		}
+
+		migrated := make(map[string]any, len(entities))
+		for _, value := range entities {
+			entity, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s contains a value that is not an object", collection)
+			}
+
+			for _, field := range []string{"id", "author_id"} {
+				n, ok := entity[field].(json.Number)
+				if !ok {
+					continue
+				}
+				i, err := n.Int64()
+				if err != nil {
+					return err
+				}
+				entity[field] = id.Legacy(int(i))
+			}
+
+			key, ok := entity["id"].(string)
+			if !ok {
+				return errors.New("found an entity without an id")
+			}
+			migrated[key] = entity
+		}
+		doc[collection] = migrated
+	}
+	return nil
+}
+
+// migrateNormalizeEmails trims and lowercases every email, the part of the normalization that does not depend on
+// configuration. It fails with ErrEmailCollision if the emails of several users become the same.
+func migrateNormalizeEmails(doc map[string]any) error {
+	users, _ := doc["users"].(map[string]any)
+
+	owners := make(map[string][]string, len(users))
+	for userID, value := range users {
+		user, ok := value.(map[string]any)
+		if !ok {
+			return errors.New("users contains a value that is not an object")
+		}
+		email, _ := user["email"].(string)
+		normalized := strings.ToLower(strings.TrimSpace(email))
+		owners[normalized] = append(owners[normalized], userID)
+	}
+
+	var collisions []string
+	for normalized, userIDs := range owners {
+		if len(userIDs) > 1 {
+			sort.Strings(userIDs)
+			collisions = append(collisions, fmt.Sprintf("users %s all normalize to %q", strings.Join(userIDs, ", "), normalized))
+			continue
+		}
+		users[userIDs[0]].(map[string]any)["email"] = normalized
+	}
+
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return fmt.Errorf("%w : %s (change their emails in the file)", ErrEmailCollision, strings.Join(collisions, "; "))
+	}
+	return nil
+}
+
+// migrateVersionEntities starts the version of every chirp and user at 1.
+func migrateVersionEntities(doc map[string]any) error {
+	for _, collection := range []string{"chirps", "users"} {
+		entities, _ := doc[collection].(map[string]any)
+		for _, value := range entities {
+			entity, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s contains a value that is not an object", collection)
+			}
+			entity["version"] = 1
+		}
+	}
+	return nil
+}
+
+// migrateHashtags stores the hashtags of the body of every chirp.
+func migrateHashtags(doc map[string]any) error {
+	chirps, _ := doc["chirps"].(map[string]any)
+	for _, value := range chirps {
+		chirp, ok := value.(map[string]any)
+		if !ok {
+			return errors.New("chirps contains a value that is not an object")
+		}
+
+		body, _ := chirp["body"].(string)
+		if hashtags := hashtag.Parse(body); len(hashtags) > 0 {
+			chirp["hashtags"] = hashtags
+		}
+	}
+	return nil
+}
+
+// migrateFollows adds the empty collection of follows, so that servers that do not know it refuse the file
+// instead of dropping the follows when they rewrite it.
+func migrateFollows(doc map[string]any) error {
+	if doc["follows"] == nil {
+		doc["follows"] = map[string]any{}
+	}
+	return nil
+}
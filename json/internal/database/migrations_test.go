@@ -0,0 +1,189 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/zoumas/chirpy/json/internal/id"
+)
+
+const versionZeroFile = `{
+	"chirps": {"1": {"id": 1, "body": "a", "author_id": 1}},
+	"users": {"1": {"id": 1, "email": "a@example.com"}},
+	"revoked_tokens": {}
+}`
+
+func TestMigrateDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	assertNoError(t, os.WriteFile(path, []byte(versionZeroFile), 0644))
+
+	applied, backupPath, err := Migrate(path, nil, true)
+	assertNoError(t, err)
+	if len(applied) != CurrentVersion || backupPath != "" {
+		t.Errorf("got %d migrations and backup %q, want %d and no backup", len(applied), backupPath, CurrentVersion)
+	}
+
+	data, err := os.ReadFile(path)
+	assertNoError(t, err)
+	if string(data) != versionZeroFile {
+		t.Error("dry run modified the database file")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	assertNoError(t, os.WriteFile(path, []byte(versionZeroFile), 0644))
+
+	_, backupPath, err := Migrate(path, nil, false)
+	assertNoError(t, err)
+
+	backup, err := os.ReadFile(backupPath)
+	assertNoError(t, err)
+	if string(backup) != versionZeroFile {
+		t.Error("backup does not hold the original file")
+	}
+
+	db := &DB{path: path}
+	dbs, _, err := db.load()
+	assertNoError(t, err)
+	if dbs.Version != CurrentVersion {
+		t.Errorf("got version %d, want %d", dbs.Version, CurrentVersion)
+	}
+
+	applied, _, err := Migrate(path, nil, false)
+	assertNoError(t, err)
+	if len(applied) != 0 {
+		t.Errorf("migrated an up to date file again: %v", applied)
+	}
+}
+
+func TestMigrateFoldsTheWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	assertNoError(t, os.WriteFile(path, []byte(versionZeroFile), 0644))
+
+	w, err := openWAL(path+walSuffix, nil)
+	assertNoError(t, err)
+	user := User{ID: id.Legacy(2), Email: "b@example.com", Version: 1}
+	assertNoError(t, w.append([]Mutation{{Op: OpPutUser, User: &user}}))
+	assertNoError(t, w.close())
+	logged, err := os.ReadFile(path + walSuffix)
+	assertNoError(t, err)
+
+	_, backupPath, err := Migrate(path, nil, false)
+	assertNoError(t, err)
+
+	backup, err := os.ReadFile(backupPath + walSuffix)
+	assertNoError(t, err)
+	if string(backup) != string(logged) {
+		t.Error("backup does not hold the original log")
+	}
+	_, err = os.Stat(path + walSuffix)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got: %v\nwant the log to be removed once folded", err)
+	}
+
+	db := &DB{path: path}
+	dbs, _, err := db.load()
+	assertNoError(t, err)
+	if _, ok := dbs.Users[user.ID]; !ok {
+		t.Error("the migrated file lacks the user from the log")
+	}
+}
+
+func TestMigrateRefusesWALOfAnotherVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	assertNoError(t, os.WriteFile(path, []byte(versionZeroFile), 0644))
+	logged := `[{"op":"put_user","user":{"id":2,"email":"b@example.com"}}]` + "\n"
+	assertNoError(t, os.WriteFile(path+walSuffix, []byte(logged), 0644))
+
+	_, _, err := Migrate(path, nil, false)
+	if !errors.Is(err, ErrWALVersion) {
+		t.Fatalf("got: %v\nwant: %v", err, ErrWALVersion)
+	}
+
+	data, err := os.ReadFile(path)
+	assertNoError(t, err)
+	if string(data) != versionZeroFile {
+		t.Error("refused migration modified the database file")
+	}
+	data, err = os.ReadFile(path + walSuffix)
+	assertNoError(t, err)
+	if string(data) != logged {
+		t.Error("refused migration modified the log")
+	}
+}
+
+func TestLoadRejectsNewerVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	assertNoError(t, os.WriteFile(path, []byte(`{"version": 1000}`), 0644))
+
+	_, err := New(path, Options{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestMigrateNormalizeEmails(t *testing.T) {
+	doc := map[string]any{
+		"users": map[string]any{
+			"1": map[string]any{"id": "1", "email": "Foo@Example.com"},
+			"2": map[string]any{"id": "2", "email": "Bar@Example.com "},
+		},
+	}
+	assertNoError(t, migrateNormalizeEmails(doc))
+
+	users := doc["users"].(map[string]any)
+	want := map[string]string{"1": "foo@example.com", "2": "bar@example.com"}
+	for userID, email := range want {
+		if got := users[userID].(map[string]any)["email"]; got != email {
+			t.Errorf("user %s: got email %q, want %q", userID, got, email)
+		}
+	}
+}
+
+func TestMigrateNormalizeEmailsRefusesCollisions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	file := `{"users": {
+		"1": {"id": 1, "email": "Foo@Example.com"},
+		"2": {"id": 2, "email": " foo@example.com"}
+	}}`
+	assertNoError(t, os.WriteFile(path, []byte(file), 0644))
+
+	_, _, err := Migrate(path, nil, false)
+	if !errors.Is(err, ErrEmailCollision) {
+		t.Fatalf("got: %v\nwant: %v", err, ErrEmailCollision)
+	}
+
+	// Recovering would move every user aside: the server refuses to start instead.
+	_, err = New(path, Options{Recover: true})
+	if !errors.Is(err, ErrEmailCollision) {
+		t.Fatalf("got: %v\nwant: %v", err, ErrEmailCollision)
+	}
+	data, err := os.ReadFile(path)
+	assertNoError(t, err)
+	if string(data) != file {
+		t.Error("refused migration modified the database file")
+	}
+}
+
+func TestMigrateHashtags(t *testing.T) {
+	doc := map[string]any{
+		"chirps": map[string]any{
+			"1": map[string]any{"id": "1", "body": "Hello #Go and #chirpy, #go again"},
+			"2": map[string]any{"id": "2", "body": "no tags here"},
+		},
+	}
+	assertNoError(t, migrateHashtags(doc))
+
+	chirps := doc["chirps"].(map[string]any)
+	got, _ := chirps["1"].(map[string]any)["hashtags"].([]string)
+	if !slices.Equal(got, []string{"go", "chirpy"}) {
+		t.Errorf("got hashtags %v, want [go chirpy]", got)
+	}
+	if _, ok := chirps["2"].(map[string]any)["hashtags"]; ok {
+		t.Error("stored hashtags on a chirp without any")
+	}
+}
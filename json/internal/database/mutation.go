@@ -0,0 +1,194 @@
+package database
+
+import "slices"
+
+// Op identifies the kind of change a Mutation makes.
+type Op string
+
+const (
+	OpPutChirp    Op = "put_chirp"
+	OpDeleteChirp Op = "delete_chirp"
+	OpPutUser     Op = "put_user"
+	OpRevokeToken Op = "revoke_token"
+	OpFollow      Op = "follow"
+	OpUnfollow    Op = "unfollow"
+
+	OpAppendEvent    Op = "append_event"
+	OpTrimEvents     Op = "trim_events"
+	OpSetEventCursor Op = "set_event_cursor"
+)
+
+// A Mutation is a single change to a DBStructure. It is the unit the write-ahead log stores.
+// Mutations carry full values rather than deltas, so replaying one that was already applied is harmless.
+type Mutation struct {
+	Op     Op      `json:"op"`
+	Chirp  *Chirp  `json:"chirp,omitempty"`
+	User   *User   `json:"user,omitempty"`
+	ID     string  `json:"id,omitempty"`
+	Token  string  `json:"token,omitempty"`
+	Follow *Follow `json:"follow,omitempty"`
+
+	Event    *Event `json:"event,omitempty"`
+	Consumer string `json:"consumer,omitempty"`
+	Seq      int64  `json:"seq,omitempty"`
+}
+
+// PutChirp creates or replaces a chirp.
+func (dbs *DBStructure) PutChirp(chirp Chirp) {
+	dbs.record(Mutation{Op: OpPutChirp, Chirp: &chirp})
+}
+
+// DeleteChirp removes the chirp with the given id, if any.
+func (dbs *DBStructure) DeleteChirp(id string) {
+	dbs.record(Mutation{Op: OpDeleteChirp, ID: id})
+}
+
+// PutUser creates or replaces a user.
+func (dbs *DBStructure) PutUser(user User) {
+	dbs.record(Mutation{Op: OpPutUser, User: &user})
+}
+
+// RevokeToken marks a refresh token as revoked.
+func (dbs *DBStructure) RevokeToken(token string) {
+	dbs.record(Mutation{Op: OpRevokeToken, Token: token})
+}
+
+// PutFollow records that follow.FollowerID follows follow.FolloweeID.
+func (dbs *DBStructure) PutFollow(follow Follow) {
+	dbs.record(Mutation{Op: OpFollow, Follow: &follow})
+}
+
+// DeleteFollow records that follow.FollowerID no longer follows follow.FolloweeID.
+func (dbs *DBStructure) DeleteFollow(follow Follow) {
+	dbs.record(Mutation{Op: OpUnfollow, Follow: &follow})
+}
+
+// AppendEvent stores event as the next event of the stream and returns it with its Seq.
+func (dbs *DBStructure) AppendEvent(event Event) Event {
+	event.Seq = dbs.LastEventSeq + 1
+	dbs.record(Mutation{Op: OpAppendEvent, Event: &event})
+	return event
+}
+
+// TrimEvents removes the events with a Seq up to seq.
+func (dbs *DBStructure) TrimEvents(seq int64) {
+	dbs.record(Mutation{Op: OpTrimEvents, Seq: seq})
+}
+
+// SetEventCursor records that consumer has processed the events up to seq.
+func (dbs *DBStructure) SetEventCursor(consumer string, seq int64) {
+	dbs.record(Mutation{Op: OpSetEventCursor, Consumer: consumer, Seq: seq})
+}
+
+// record applies m and remembers it, together with how to undo it, until the surrounding Update finishes.
+func (dbs *DBStructure) record(m Mutation) {
+	dbs.undo = append(dbs.undo, dbs.undoFunc(m))
+	dbs.apply(m)
+	dbs.changes = append(dbs.changes, m)
+}
+
+// apply makes the change described by m.
+func (dbs *DBStructure) apply(m Mutation) {
+	switch m.Op {
+	case OpPutChirp:
+		dbs.setChirp(*m.Chirp)
+	case OpDeleteChirp:
+		dbs.removeChirp(m.ID)
+	case OpPutUser:
+		dbs.setUser(*m.User)
+	case OpRevokeToken:
+		dbs.RevokedTokens[m.Token] = struct{}{}
+	case OpFollow:
+		dbs.setFollow(*m.Follow)
+	case OpUnfollow:
+		dbs.removeFollow(*m.Follow)
+	case OpAppendEvent:
+		// The event is already there when a log entry is replayed on top of a snapshot that contains it.
+		if m.Event.Seq > dbs.LastEventSeq {
+			dbs.Events = append(dbs.Events, *m.Event)
+			dbs.LastEventSeq = m.Event.Seq
+		}
+	case OpTrimEvents:
+		i := 0
+		for i < len(dbs.Events) && dbs.Events[i].Seq <= m.Seq {
+			i++
+		}
+		dbs.Events = slices.Clone(dbs.Events[i:])
+	case OpSetEventCursor:
+		dbs.EventCursors[m.Consumer] = m.Seq
+	}
+}
+
+// undoFunc returns a function that restores the state m is about to change.
+func (dbs *DBStructure) undoFunc(m Mutation) func() {
+	switch m.Op {
+	case OpPutChirp, OpDeleteChirp:
+		id := m.ID
+		if m.Op == OpPutChirp {
+			id = m.Chirp.ID
+		}
+		old, ok := dbs.Chirps[id]
+		return func() {
+			if ok {
+				dbs.setChirp(old)
+			} else {
+				dbs.removeChirp(id)
+			}
+		}
+	case OpPutUser:
+		old, ok := dbs.Users[m.User.ID]
+		return func() {
+			if ok {
+				dbs.setUser(old)
+			} else {
+				dbs.removeUser(m.User.ID)
+			}
+		}
+	case OpRevokeToken:
+		_, ok := dbs.RevokedTokens[m.Token]
+		return func() {
+			if !ok {
+				delete(dbs.RevokedTokens, m.Token)
+			}
+		}
+	case OpFollow, OpUnfollow:
+		_, ok := dbs.Follows[m.Follow.FollowerID][m.Follow.FolloweeID]
+		return func() {
+			if ok {
+				dbs.setFollow(*m.Follow)
+			} else {
+				dbs.removeFollow(*m.Follow)
+			}
+		}
+	case OpAppendEvent, OpTrimEvents:
+		events, lastSeq := dbs.Events, dbs.LastEventSeq
+		return func() {
+			dbs.Events, dbs.LastEventSeq = events, lastSeq
+		}
+	case OpSetEventCursor:
+		old, ok := dbs.EventCursors[m.Consumer]
+		return func() {
+			if ok {
+				dbs.EventCursors[m.Consumer] = old
+			} else {
+				delete(dbs.EventCursors, m.Consumer)
+			}
+		}
+	}
+	return func() {}
+}
+
+// rollback undoes every change recorded since the last commit or rollback.
+func (dbs *DBStructure) rollback() {
+	for i := len(dbs.undo) - 1; i >= 0; i-- {
+		dbs.undo[i]()
+	}
+	dbs.changes, dbs.undo = nil, nil
+}
+
+// commit forgets the recorded changes and returns them.
+func (dbs *DBStructure) commit() []Mutation {
+	changes := dbs.changes
+	dbs.changes, dbs.undo = nil, nil
+	return changes
+}
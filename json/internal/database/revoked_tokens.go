@@ -1,6 +1,8 @@
 package database
 
+import "context"
+
 type RevokedTokensRepository interface {
-	Revoke(token string) error
-	IsRevoked(token string) (bool, error)
+	Revoke(ctx context.Context, token string) error
+	IsRevoked(ctx context.Context, token string) (bool, error)
 }
@@ -0,0 +1,408 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/zoumas/chirpy/json/internal/hashtag"
+	"github.com/zoumas/chirpy/json/internal/id"
+)
+
+// A SQLiteMigration changes the schema of the SQLite database from Version-1 to Version inside a transaction.
+type SQLiteMigration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+}
+
+// sqliteMigrations holds the schema of the SQLite database.
+// The version of a migration is its index + 1 and is tracked with PRAGMA user_version.
+// Migrations are append-only: never edit one that has already been released.
+var sqliteMigrations = []SQLiteMigration{
+	{Version: 1, Description: "create users, chirps and revoked_tokens", Up: execMigration(`
+	CREATE TABLE users (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		email         TEXT    NOT NULL UNIQUE,
+		password      TEXT    NOT NULL,
+		is_chirpy_red BOOLEAN NOT NULL DEFAULT FALSE
+	);
+
+	CREATE TABLE chirps (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		body      TEXT    NOT NULL,
+		author_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE revoked_tokens (
+		token TEXT PRIMARY KEY
+	);
+	`)},
+	{Version: 2, Description: "replace integer IDs with ULIDs", Up: migrateSQLiteToULIDs},
+	{Version: 3, Description: "index chirps by author", Up: execMigration(`
+	CREATE INDEX chirps_author_id ON chirps (author_id);
+	`)},
+	{Version: 4, Description: "normalize emails", Up: migrateSQLiteNormalizeEmails},
+	{Version: 5, Description: "soft delete chirps", Up: execMigration(`
+	ALTER TABLE chirps ADD COLUMN deleted_at DATETIME;
+	CREATE INDEX chirps_deleted_at ON chirps (deleted_at);
+	`)},
+	{Version: 6, Description: "version chirps and users", Up: execMigration(`
+	ALTER TABLE chirps ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+	`)},
+	{Version: 7, Description: "create events and event_cursors", Up: execMigration(`
+	CREATE TABLE events (
+		seq        INTEGER  PRIMARY KEY AUTOINCREMENT,
+		type       TEXT     NOT NULL,
+		created_at DATETIME NOT NULL,
+		data       TEXT     NOT NULL
+	);
+	CREATE INDEX events_created_at ON events (created_at);
+
+	CREATE TABLE event_cursors (
+		consumer TEXT    PRIMARY KEY,
+		seq      INTEGER NOT NULL
+	);
+	`)},
+	{Version: 8, Description: "index chirps by author and id", Up: execMigration(`
+	DROP INDEX chirps_author_id;
+	CREATE INDEX chirps_author_id_id ON chirps (author_id, id);
+	`)},
+	{Version: 9, Description: "extract hashtags", Up: migrateSQLiteHashtags},
+	{Version: 10, Description: "add handles and profiles to users", Up: execMigration(`
+	ALTER TABLE users ADD COLUMN handle TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN previous_handle TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN handle_changed_at TIMESTAMP;
+	ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN location TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN website TEXT NOT NULL DEFAULT '';
+
+	CREATE UNIQUE INDEX users_handle ON users (handle) WHERE handle != '';
+	CREATE INDEX users_previous_handle ON users (previous_handle) WHERE previous_handle != '';
+	`)},
+	// Existing chirps are not scanned: mentions are resolved against the handles of the time a chirp is created.
+	// user_id does not reference users, so a mention outlives its user.
+	{Version: 11, Description: "add mentions to chirps", Up: execMigration(`
+	ALTER TABLE chirps ADD COLUMN mentions TEXT NOT NULL DEFAULT '';
+
+	CREATE TABLE chirp_mentions (
+		user_id  TEXT NOT NULL,
+		chirp_id TEXT NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+		PRIMARY KEY (user_id, chirp_id)
+	);
+	`)},
+	{Version: 12, Description: "add follows", Up: execMigration(`
+	CREATE TABLE follows (
+		follower_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		followee_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		PRIMARY KEY (follower_id, followee_id)
+	);
+
+	CREATE INDEX follows_followee ON follows (followee_id);
+	`)},
+}
+
+// execMigration returns a migration that executes the given statements.
+func execMigration(statements string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// migrateSQLiteToULIDs replaces the integer IDs of users and chirps with ULIDs.
+// Every integer ID n becomes id.Legacy(n), so existing rows keep their order.
+func migrateSQLiteToULIDs(tx *sql.Tx) error {
+	// Renaming users_ulid to users also renames the reference chirps_ulid holds to it.
+	_, err := tx.Exec(`
+	CREATE TABLE users_ulid (
+		id            TEXT    PRIMARY KEY,
+		email         TEXT    NOT NULL UNIQUE,
+		password      TEXT    NOT NULL,
+		is_chirpy_red BOOLEAN NOT NULL DEFAULT FALSE
+	);
+
+	CREATE TABLE chirps_ulid (
+		id        TEXT PRIMARY KEY,
+		body      TEXT NOT NULL,
+		author_id TEXT NOT NULL REFERENCES users_ulid (id) ON DELETE CASCADE
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = copyWithLegacyIDs(
+		tx,
+		"SELECT id, email, password, is_chirpy_red FROM users",
+		"INSERT INTO users_ulid (id, email, password, is_chirpy_red) VALUES (?, ?, ?, ?)",
+		func(scan func(...any) error) ([]any, error) {
+			var userID int
+			var email, password string
+			var isChirpyRed bool
+			err := scan(&userID, &email, &password, &isChirpyRed)
+			return []any{id.Legacy(userID), email, password, isChirpyRed}, err
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = copyWithLegacyIDs(
+		tx,
+		"SELECT id, body, author_id FROM chirps",
+		"INSERT INTO chirps_ulid (id, body, author_id) VALUES (?, ?, ?)",
+		func(scan func(...any) error) ([]any, error) {
+			var chirpID, authorID int
+			var body string
+			err := scan(&chirpID, &body, &authorID)
+			return []any{id.Legacy(chirpID), body, id.Legacy(authorID)}, err
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	DROP TABLE chirps;
+	DROP TABLE users;
+	ALTER TABLE users_ulid RENAME TO users;
+	ALTER TABLE chirps_ulid RENAME TO chirps;
+	`)
+	return err
+}
+
+// migrateSQLiteNormalizeEmails trims and lowercases every email.
+// It fails with ErrEmailCollision if the emails of several users become the same.
+func migrateSQLiteNormalizeEmails(tx *sql.Tx) error {
+	rows, err := tx.Query(`
+	SELECT lower(trim(email)), group_concat(id, ', ')
+	FROM users
+	GROUP BY lower(trim(email))
+	HAVING count(*) > 1
+	`)
+	if err != nil {
+		return err
+	}
+	var collisions []string
+	for rows.Next() {
+		var normalized, userIDs string
+		err := rows.Scan(&normalized, &userIDs)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		collisions = append(collisions, fmt.Sprintf("users %s all normalize to %q", userIDs, normalized))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("%w : %s (change their emails in the database)", ErrEmailCollision, strings.Join(collisions, "; "))
+	}
+
+	_, err = tx.Exec("UPDATE users SET email = lower(trim(email))")
+	return err
+}
+
+// migrateSQLiteHashtags stores the hashtags of every chirp, space separated, in chirps.hashtags,
+// and indexes them in chirp_hashtags.
+func migrateSQLiteHashtags(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	ALTER TABLE chirps ADD COLUMN hashtags TEXT NOT NULL DEFAULT '';
+
+	CREATE TABLE chirp_hashtags (
+		hashtag  TEXT NOT NULL,
+		chirp_id TEXT NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+		PRIMARY KEY (hashtag, chirp_id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, body FROM chirps")
+	if err != nil {
+		return err
+	}
+	tagged := map[string][]string{}
+	for rows.Next() {
+		var chirpID, body string
+		err := rows.Scan(&chirpID, &body)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if hashtags := hashtag.Parse(body); len(hashtags) > 0 {
+			tagged[chirpID] = hashtags
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for chirpID, hashtags := range tagged {
+		_, err := tx.Exec("UPDATE chirps SET hashtags = ? WHERE id = ?", strings.Join(hashtags, " "), chirpID)
+		if err != nil {
+			return err
+		}
+		for _, tag := range hashtags {
+			_, err := tx.Exec("INSERT INTO chirp_hashtags (hashtag, chirp_id) VALUES (?, ?)", tag, chirpID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyWithLegacyIDs inserts every row returned by query with insert, after convert has turned it into the new values.
+func copyWithLegacyIDs(
+	tx *sql.Tx,
+	query string,
+	insert string,
+	convert func(scan func(...any) error) ([]any, error),
+) error {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return err
+	}
+
+	converted := [][]any{}
+	for rows.Next() {
+		values, err := convert(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		converted = append(converted, values)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, values := range converted {
+		_, err := tx.Exec(insert, values...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewSQLite opens the SQLite database at path, creating it if it does not exist,
+// and brings its schema up to date.
+func NewSQLite(path string) (*sql.DB, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := pendingSQLiteMigrations(db)
+	if err == nil {
+		err = migrateSQLite(db, pending)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// MigrateSQLite brings the schema of the SQLite database at path up to date and returns the migrations it applied.
+// The database is copied to backupPath before any migration runs.
+// With dryRun set the database is left untouched and the migrations that would run are returned.
+func MigrateSQLite(path string, dryRun bool) (applied []SQLiteMigration, backupPath string, err error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer db.Close()
+
+	pending, err := pendingSQLiteMigrations(db)
+	if err != nil {
+		return nil, "", err
+	}
+	if dryRun || len(pending) == 0 {
+		return pending, "", nil
+	}
+
+	backupPath = fmt.Sprintf("%s.backup-v%d-%d", path, pending[0].Version-1, time.Now().Unix())
+	_, err = db.Exec("VACUUM INTO ?", backupPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to back up the database : %s", err)
+	}
+
+	err = migrateSQLite(db, pending)
+	if err != nil {
+		return nil, "", err
+	}
+	return pending, backupPath, nil
+}
+
+func openSQLite(path string) (*sql.DB, error) {
+	// Transactions take the write lock when they begin: a transaction that reads then writes
+	// would otherwise fail with "database is locked", without waiting, when another one writes concurrently.
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate", path))
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// pendingSQLiteMigrations returns the migrations newer than the current schema version, tracked with PRAGMA user_version.
+func pendingSQLiteMigrations(db *sql.DB) ([]SQLiteMigration, error) {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return nil, err
+	}
+
+	if version > len(sqliteMigrations) {
+		return nil, fmt.Errorf("database schema version %d is newer than this server supports (%d)", version, len(sqliteMigrations))
+	}
+	return sqliteMigrations[version:], nil
+}
+
+// migrateSQLite applies the given migrations in order.
+// Each migration runs in its own transaction together with the version bump.
+func migrateSQLite(db *sql.DB, migrations []SQLiteMigration) error {
+	for _, migration := range migrations {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		err = migration.Up(tx)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d : %w", migration.Version, err)
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", migration.Version))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
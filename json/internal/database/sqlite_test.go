@@ -0,0 +1,108 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/zoumas/chirpy/json/internal/id"
+)
+
+func TestNewSQLiteMigratesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.db")
+
+	db, err := NewSQLite(path)
+	if err != nil {
+		t.Fatalf("Unexpected error : %q", err)
+	}
+	_, err = db.Exec("INSERT INTO users (id, email, password) VALUES ('01HFY0XJQGW5MBZ7MTV5S3Q2RD', 'a@example.com', 'hash')")
+	if err != nil {
+		t.Fatalf("Unexpected error : %q", err)
+	}
+	db.Close()
+
+	// Reopening must not re-run migrations nor lose data.
+	db, err = NewSQLite(path)
+	if err != nil {
+		t.Fatalf("Unexpected error : %q", err)
+	}
+	defer db.Close()
+
+	var version, users int
+	db.QueryRow("PRAGMA user_version").Scan(&version)
+	db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users)
+
+	if version != len(sqliteMigrations) {
+		t.Errorf("got schema version %d, want %d", version, len(sqliteMigrations))
+	}
+	if users != 1 {
+		t.Errorf("got %d users, want 1", users)
+	}
+}
+
+func TestSQLiteMigratesIntegerIDsToULIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.db")
+
+	// Create a database with the schema from before IDs were ULIDs.
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on")
+	assertNoError(t, err)
+	tx, err := db.Begin()
+	assertNoError(t, err)
+	assertNoError(t, sqliteMigrations[0].Up(tx))
+	_, err = tx.Exec("PRAGMA user_version = 1")
+	assertNoError(t, err)
+	assertNoError(t, tx.Commit())
+	_, err = db.Exec(`
+	INSERT INTO users (email, password) VALUES ('a@example.com', 'hash');
+	INSERT INTO chirps (body, author_id) VALUES ('first', 1), ('second', 1);
+	`)
+	assertNoError(t, err)
+	db.Close()
+
+	db, err = NewSQLite(path)
+	assertNoError(t, err)
+	defer db.Close()
+
+	var chirpID, authorID string
+	err = db.QueryRow("SELECT id, author_id FROM chirps WHERE body = 'second'").Scan(&chirpID, &authorID)
+	assertNoError(t, err)
+	if chirpID != id.Legacy(2) || authorID != id.Legacy(1) {
+		t.Errorf("got chirp %q by %q, want %q by %q", chirpID, authorID, id.Legacy(2), id.Legacy(1))
+	}
+
+	// The foreign key still points at the users table after the rename.
+	_, err = db.Exec("DELETE FROM users")
+	assertNoError(t, err)
+	var chirps int
+	db.QueryRow("SELECT COUNT(*) FROM chirps").Scan(&chirps)
+	if chirps != 0 {
+		t.Errorf("got %d chirps after deleting their author, want 0", chirps)
+	}
+}
+
+func TestSQLiteNormalizeEmailsRefusesCollisions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.db")
+
+	// Create a database with the schema from before emails were normalized.
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on")
+	assertNoError(t, err)
+	tx, err := db.Begin()
+	assertNoError(t, err)
+	for _, migration := range sqliteMigrations[:3] {
+		assertNoError(t, migration.Up(tx))
+	}
+	_, err = tx.Exec("PRAGMA user_version = 3")
+	assertNoError(t, err)
+	assertNoError(t, tx.Commit())
+	_, err = db.Exec(`
+	INSERT INTO users (id, email, password) VALUES ('1', 'Foo@Example.com', 'hash'), ('2', 'foo@example.com', 'hash');
+	`)
+	assertNoError(t, err)
+	db.Close()
+
+	_, err = NewSQLite(path)
+	if !errors.Is(err, ErrEmailCollision) {
+		t.Fatalf("got: %v\nwant: %v", err, ErrEmailCollision)
+	}
+}
@@ -1,26 +1,138 @@
 package database
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type UserErr string
+
+func (e UserErr) Error() string {
+	return string(e)
+}
+
+// Errors every UserRepository returns.
+const (
+	ErrUserNotFound    = UserErr("User not found")
+	ErrUserEmailTaken  = UserErr("Email taken")
+	ErrUserHandleTaken = UserErr("Handle taken")
+	// ErrUserVersionMismatch is returned when a user is no longer at the version a change expects.
+	ErrUserVersionMismatch = UserErr("User was modified")
+	// ErrUserHandleChangedRecently is returned when a handle changes again sooner than UpdateUserParams allows.
+	ErrUserHandleChangedRecently = UserErr("Handle changed too recently")
+)
+
+// ErrEmailCollision is returned when the stored emails of several users are the same once normalized.
+// Only one of them could log in, and merging accounts has to be decided by a person.
+var ErrEmailCollision = errors.New("stored emails collide once normalized")
+
 type User struct {
-	ID          int    `json:"id"`
+	ID          string `json:"id"`
 	Email       string `json:"email"`
 	Password    string `json:"password"`
 	IsChirpyRed bool   `json:"is_chirpy_red"`
+	// Handle is the unique public name of the user, normalized. It is empty until the user picks one.
+	Handle string `json:"handle,omitempty"`
+	// PreviousHandle is the handle the user had before Handle. It still leads to the user until someone else takes it.
+	PreviousHandle string `json:"previous_handle,omitempty"`
+	// HandleChangedAt is when Handle last replaced another handle. Picking the first handle does not set it.
+	HandleChangedAt *time.Time `json:"handle_changed_at,omitempty"`
+	Profile
+	// Version starts at 1 and is incremented by every change of the user.
+	Version int `json:"version"`
+}
+
+// Profile is what users choose to tell about themselves publicly. Every field is optional.
+type Profile struct {
+	DisplayName string `json:"display_name,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Website     string `json:"website,omitempty"`
 }
 
 type CreateUserParams struct {
 	Email    string
 	Password string
+	// Handle is optional.
+	Handle string
 }
 
 type UpdateUserParams struct {
-	Email    string
-	Password string
+	// Every field is left unchanged when nil.
+	Email       *string
+	Password    *string
+	Handle      *string
+	DisplayName *string
+	Bio         *string
+	Location    *string
+	Website     *string
+	// HandleUnchangedSince, unless zero, rate limits handle changes: the handle cannot change if it changed after it.
+	HandleUnchangedSince time.Time
+	// IfVersions, unless empty, are the versions the user must be at: any of them.
+	IfVersions Versions
+}
+
+// Apply returns user changed as params describe, at its next version. Handle changes are dated now.
+// Repositories check that the email and handle are not taken by another user themselves.
+func (params UpdateUserParams) Apply(user User, now time.Time) (User, error) {
+	if !params.IfVersions.Match(user.Version) {
+		return User{}, ErrUserVersionMismatch
+	}
+
+	if params.Handle != nil && *params.Handle != user.Handle {
+		if user.Handle != "" {
+			if !params.HandleUnchangedSince.IsZero() && user.HandleChangedAt != nil &&
+				user.HandleChangedAt.After(params.HandleUnchangedSince) {
+				return User{}, ErrUserHandleChangedRecently
+			}
+			changedAt := now.UTC()
+			user.PreviousHandle = user.Handle
+			user.HandleChangedAt = &changedAt
+		}
+		user.Handle = *params.Handle
+	}
+
+	if params.DisplayName != nil {
+		user.DisplayName = *params.DisplayName
+	}
+	if params.Bio != nil {
+		user.Bio = *params.Bio
+	}
+	if params.Location != nil {
+		user.Location = *params.Location
+	}
+	if params.Website != nil {
+		user.Website = *params.Website
+	}
+
+	if params.Email != nil {
+		user.Email = *params.Email
+	}
+	if params.Password != nil {
+		user.Password = *params.Password
+	}
+	user.Version++
+	return user, nil
+}
+
+// ListUsersParams select a page of users, in ID order.
+type ListUsersParams struct {
+	// After, unless empty, is the ID of the last user of the previous page: the page starts right after it.
+	After string
+	Limit int
 }
 
 type UserRepository interface {
-	Create(params CreateUserParams) (User, error)
-	GetByEmail(email string) (User, error)
-	GetByID(id int) (User, error)
-	Update(id int, params UpdateUserParams) (User, error)
-	UpgradeToRed(id int) (User, error)
+	Create(ctx context.Context, params CreateUserParams) (User, error)
+	GetByEmail(ctx context.Context, email string) (User, error)
+	// GetByHandle returns the user whose handle is handle or, if no user has it, the user whose previous handle it is.
+	// Callers tell the two apart by comparing handle with the Handle of the user.
+	GetByHandle(ctx context.Context, handle string) (User, error)
+	GetByID(ctx context.Context, id string) (User, error)
+	GetAll(ctx context.Context) ([]User, error)
+	// List returns a page of at most params.Limit users.
+	List(ctx context.Context, params ListUsersParams) ([]User, error)
+	Update(ctx context.Context, id string, params UpdateUserParams) (User, error)
+	UpgradeToRed(ctx context.Context, id string) (User, error)
 }
@@ -0,0 +1,11 @@
+package database
+
+import "slices"
+
+// Versions are the versions a user or chirp may be at for a change to apply. Empty allows any version.
+type Versions []int
+
+// Match reports whether version is one of v, or v allows any version.
+func (v Versions) Match(version int) bool {
+	return len(v) == 0 || slices.Contains(v, version)
+}
@@ -0,0 +1,357 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// walSuffix is appended to the path of the snapshot to name the write-ahead log.
+const walSuffix = ".wal"
+
+// rotatedSuffix is appended to the path of the log to name the log set aside by a compaction in progress.
+const rotatedSuffix = ".old"
+
+// DefaultCompactThreshold is the number of logged transactions after which the log is compacted into the snapshot.
+const DefaultCompactThreshold = 1000
+
+// compactCheckInterval is how often the background compaction checks the size of the log.
+const compactCheckInterval = 5 * time.Second
+
+// ErrWALVersion is returned when the write-ahead log holds entries of another schema version than the snapshot
+// they are replayed on. The server that wrote them must compact the log, by stopping cleanly, before the upgrade.
+var ErrWALVersion = errors.New("write-ahead log was written with another schema version")
+
+// walEntry is a line of the log: the mutations of one Update and the schema version they were written with.
+// Entries written before entries were versioned are a bare JSON array of mutations, and are refused like
+// entries of another version: migrations upgrade the snapshot, not the log.
+type walEntry struct {
+	Version int             `json:"version"`
+	Changes json.RawMessage `json:"changes"`
+}
+
+// wal is an append-only log of committed transactions.
+// Each line is the JSON encoding of the walEntry of one Update, encrypted on its own when there are keys.
+type wal struct {
+	path    string
+	f       *os.File
+	entries int
+	keys    *Keyring
+	// broken is set when a failed append could not be rolled back.
+	// The log then ends in a partial entry, so appending is refused until it is truncated.
+	broken error
+	// rotated is set while a log set aside by Compact exists, until the snapshot that contains it is written.
+	rotated bool
+}
+
+func openWAL(path string, keys *Keyring) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.Chmod(fileMode)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &wal{path: path, f: f, keys: keys}, nil
+}
+
+// append durably writes the mutations of a single transaction to the log.
+// If the entry cannot be written in full, the log is truncated back to where it ended before,
+// so a rolled back transaction is never replayed and later entries are not glued to a partial one.
+func (w *wal) append(changes []Mutation) error {
+	if w.broken != nil {
+		return fmt.Errorf("write-ahead log is unusable until it is compacted : %w", w.broken)
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(walEntry{Version: CurrentVersion, Changes: data})
+	if err != nil {
+		return err
+	}
+
+	data, err = w.keys.seal(data)
+	if err != nil {
+		return err
+	}
+
+	offset, err := w.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	_, err = write(w.f, append(data, '\n'))
+	if err == nil {
+		err = w.f.Sync()
+	}
+	if err != nil {
+		truncErr := w.f.Truncate(offset)
+		if truncErr != nil {
+			w.broken = truncErr
+			return fmt.Errorf("%w : failed to roll back the write-ahead log : %s", err, truncErr)
+		}
+		return err
+	}
+	w.entries++
+	return nil
+}
+
+// truncate empties the log once its entries are contained in the snapshot.
+func (w *wal) truncate() error {
+	err := w.f.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	err = w.f.Sync()
+	if err != nil {
+		return err
+	}
+	w.entries = 0
+	w.broken = nil
+	return nil
+}
+
+// rotate sets the log aside for a compaction and starts a new, empty one.
+// Entries appended from then on go to the new log, so the snapshot can be written without blocking updates.
+func (w *wal) rotate() error {
+	err := os.Rename(w.path, w.path+rotatedSuffix)
+	if err != nil {
+		return err
+	}
+
+	next, err := openWAL(w.path, w.keys)
+	if err != nil {
+		// Keep appending to a file that is replayed as the log.
+		return errors.Join(err, os.Rename(w.path+rotatedSuffix, w.path))
+	}
+
+	err = w.f.Close()
+	if err != nil {
+		log.Printf("failed to close the rotated write-ahead log : %s", err)
+	}
+	w.f = next.f
+	w.entries = 0
+	w.broken = nil
+	w.rotated = true
+	return nil
+}
+
+// removeRotated deletes the log set aside by rotate once a snapshot containing its entries is on disk.
+func (w *wal) removeRotated() error {
+	err := os.Remove(w.path + rotatedSuffix)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	w.rotated = false
+	return nil
+}
+
+func (w *wal) close() error {
+	return w.f.Close()
+}
+
+// replayWALs applies the log set aside by an unfinished compaction, if any, and then the log of the snapshot at path.
+func replayWALs(path string, dbs *DBStructure, keys *Keyring) (entries int, stale bool, err error) {
+	for _, path := range []string{path + walSuffix + rotatedSuffix, path + walSuffix} {
+		n, staleLog, err := replayWAL(path, dbs, keys)
+		entries += n
+		stale = stale || staleLog
+		if err != nil {
+			return entries, stale, err
+		}
+	}
+	return entries, stale, nil
+}
+
+// replayWAL applies every transaction stored in the log at path to dbs and returns how many it applied.
+// stale reports whether any of them is not encrypted with the primary key.
+// A torn last line, left by a crash in the middle of an append, is ignored.
+// Entries of another schema version than CurrentVersion, or without a version, fail with ErrWALVersion.
+func replayWAL(path string, dbs *DBStructure, keys *Keyring) (entries int, stale bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Printf("ignoring torn entry at the end of %s", path)
+			}
+			return entries, stale, nil
+		}
+		if err != nil {
+			return entries, stale, err
+		}
+
+		line, staleLine, err := keys.open(line)
+		if err != nil {
+			return entries, stale, fmt.Errorf("entry %d of %s : %w", entries+1, path, err)
+		}
+		stale = stale || staleLine
+
+		changes, err := decodeWALEntry(line)
+		if errors.Is(err, ErrWALVersion) {
+			return entries, stale, fmt.Errorf("entry %d of %s : %w", entries+1, path, err)
+		}
+		if err != nil {
+			return entries, stale, fmt.Errorf("%w : entry %d of %s : %s", ErrCorrupt, entries+1, path, err)
+		}
+
+		for _, m := range changes {
+			dbs.apply(m)
+		}
+		entries++
+	}
+}
+
+// decodeWALEntry returns the mutations of a line of the log.
+func decodeWALEntry(line []byte) ([]Mutation, error) {
+	data := bytes.TrimSpace(line)
+	if bytes.HasPrefix(data, []byte("[")) {
+		return nil, fmt.Errorf("%w : entry without a version", ErrWALVersion)
+	}
+
+	entry := walEntry{}
+	err := json.Unmarshal(data, &entry)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Version != CurrentVersion {
+		return nil, fmt.Errorf("%w : version %d, want %d", ErrWALVersion, entry.Version, CurrentVersion)
+	}
+
+	changes := []Mutation{}
+	err = json.Unmarshal(entry.Changes, &changes)
+	return changes, err
+}
+
+// openWAL switches db to write-ahead log mode: the log is replayed on top of the loaded snapshot
+// and every Update from then on is appended to it.
+func (db *DB) openWAL(compactThreshold int) error {
+	entries, stale, err := replayWALs(db.path, &db.state, db.keys)
+	if err != nil {
+		return err
+	}
+	db.stale = db.stale || stale
+
+	_, err = os.Stat(db.path + walSuffix + rotatedSuffix)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	rotated := err == nil
+
+	db.wal, err = openWAL(db.path+walSuffix, db.keys)
+	if err != nil {
+		return err
+	}
+	db.wal.entries = entries
+	db.wal.rotated = rotated
+	db.compactThreshold = compactThreshold
+	return nil
+}
+
+// compactIfNeeded folds the log into the snapshot once it grows past the compaction threshold,
+// or as soon as a failed append has left it unusable.
+func (db *DB) compactIfNeeded() {
+	db.mu.RLock()
+	entries, broken := db.wal.entries, db.wal.broken
+	db.mu.RUnlock()
+
+	if entries < db.compactThreshold && broken == nil {
+		return
+	}
+
+	err := db.Compact()
+	if err != nil {
+		log.Printf("failed to compact the write-ahead log : %s", err)
+	}
+}
+
+// Compact writes the in-memory state to the snapshot and discards the log it contains.
+// The log is set aside under the write lock, which only takes a rename, and the state is encoded under the read lock,
+// so updates are not blocked while the snapshot is written. The log set aside is deleted once the snapshot is on disk.
+// A crash before that is harmless: replaying mutations the snapshot already contains changes nothing.
+func (db *DB) Compact() error {
+	if db.wal == nil {
+		return nil
+	}
+
+	// A Restore in progress must not be overwritten with the old state.
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+
+	// A log left aside by a compaction that failed cannot be replaced: finish that compaction first.
+	if db.wal.rotated {
+		err := db.writeSnapshot()
+		if err != nil {
+			return err
+		}
+		err = db.wal.removeRotated()
+		if err != nil {
+			return err
+		}
+	}
+
+	db.mu.Lock()
+	if db.wal.entries == 0 && db.wal.broken == nil {
+		db.mu.Unlock()
+		return nil
+	}
+	err := db.wal.rotate()
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = db.writeSnapshot()
+	if err != nil {
+		return err
+	}
+	return db.wal.removeRotated()
+}
+
+// writeSnapshot writes the current state to the snapshot, holding the read lock only while encoding it.
+func (db *DB) writeSnapshot() error {
+	db.mu.RLock()
+	data, err := json.MarshalIndent(db.state, "", "\t")
+	db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	data, err = db.keys.seal(data)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(db.path, data, fileMode)
+}
+
+// removeWAL deletes the log of the snapshot at path and the log set aside by an unfinished compaction.
+func removeWAL(path string) error {
+	for _, path := range []string{path + walSuffix, path + walSuffix + rotatedSuffix} {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
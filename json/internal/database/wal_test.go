@@ -0,0 +1,224 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWALReplaysLogOnStartup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	db, err := New(path, Options{WAL: true})
+	assertNoError(t, err)
+	putUsers(t, db, 3)
+
+	crash(t, db)
+
+	db, err = New(path, Options{WAL: true})
+	assertNoError(t, err)
+	defer db.Close()
+	assertUsers(t, db, 3)
+}
+
+func TestWALIgnoresTornLastEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	db, err := New(path, Options{WAL: true})
+	assertNoError(t, err)
+	putUsers(t, db, 2)
+	crash(t, db)
+
+	f, err := os.OpenFile(path+walSuffix, os.O_WRONLY|os.O_APPEND, 0644)
+	assertNoError(t, err)
+	_, err = f.Write([]byte(`[{"op":"put_user","user":{"id":3,`))
+	assertNoError(t, err)
+	f.Close()
+
+	db, err = New(path, Options{WAL: true})
+	assertNoError(t, err)
+	defer db.Close()
+	assertUsers(t, db, 2)
+}
+
+func TestWALCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	db, err := New(path, Options{WAL: true})
+	assertNoError(t, err)
+	putUsers(t, db, 3)
+	assertNoError(t, db.Compact())
+
+	info, err := os.Stat(path + walSuffix)
+	assertNoError(t, err)
+	if info.Size() != 0 {
+		t.Errorf("got a log of %d bytes after compaction, want 0", info.Size())
+	}
+	assertNoError(t, db.Close())
+
+	// The snapshot alone holds the data now.
+	db, err = New(path, Options{})
+	assertNoError(t, err)
+	assertUsers(t, db, 3)
+}
+
+func TestWALReplaysLogLeftByInterruptedCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	db, err := New(path, Options{WAL: true})
+	assertNoError(t, err)
+	putUsers(t, db, 2)
+	crash(t, db)
+
+	// A crash right after Compact set the log aside, before the snapshot was written.
+	assertNoError(t, os.Rename(path+walSuffix, path+walSuffix+rotatedSuffix))
+
+	db, err = New(path, Options{WAL: true})
+	assertNoError(t, err)
+	assertUsers(t, db, 2)
+	putUsers(t, db, 3)
+	assertNoError(t, db.Compact())
+	assertNoError(t, db.Close())
+
+	_, err = os.Stat(path + walSuffix + rotatedSuffix)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got: %v\nwant the log set aside to be removed after compaction", err)
+	}
+
+	// The snapshot alone holds the data now.
+	db, err = New(path, Options{})
+	assertNoError(t, err)
+	assertUsers(t, db, 3)
+}
+
+func TestWALRejectsEntriesOfAnotherVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	db, err := New(path, Options{WAL: true})
+	assertNoError(t, err)
+	assertNoError(t, db.Close())
+
+	entry := fmt.Sprintf(`{"version":%d,"changes":[]}`+"\n", CurrentVersion+1)
+	assertNoError(t, os.WriteFile(path+walSuffix, []byte(entry), 0644))
+
+	_, err = New(path, Options{WAL: true, Recover: true})
+	if !errors.Is(err, ErrWALVersion) {
+		t.Fatalf("got: %v\nwant: %v", err, ErrWALVersion)
+	}
+}
+
+func TestWALRejectsEntriesWithoutVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	db, err := New(path, Options{WAL: true})
+	assertNoError(t, err)
+	assertNoError(t, db.Close())
+
+	logged := `[{"op":"put_user","user":{"id":"2","email":"b@example.com"}}]` + "\n"
+	assertNoError(t, os.WriteFile(path+walSuffix, []byte(logged), 0644))
+
+	for _, options := range []Options{{WAL: true}, {}} {
+		_, err = New(path, options)
+		if !errors.Is(err, ErrWALVersion) {
+			t.Fatalf("got: %v\nwant: %v", err, ErrWALVersion)
+		}
+	}
+}
+
+func TestWALRollsBackFailedUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	db, err := New(path, Options{WAL: true})
+	assertNoError(t, err)
+	defer db.Close()
+	putUsers(t, db, 1)
+
+	errAbort := errors.New("abort")
+	err = db.Update(context.Background(), func(dbs *DBStructure) error {
+		dbs.PutUser(User{ID: "1", Email: "changed@example.com"})
+		dbs.PutUser(User{ID: "2", Email: "new@example.com"})
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("got: %v\nwant: %v", err, errAbort)
+	}
+
+	assertUsers(t, db, 1)
+	db.View(context.Background(), func(dbs *DBStructure) error {
+		if got := dbs.Users["1"].Email; got != "user1@example.com" {
+			t.Errorf("got email %q, want the change to be rolled back", got)
+		}
+		return nil
+	})
+}
+
+func putUsers(t testing.TB, db *DB, n int) {
+	t.Helper()
+
+	for i := 1; i <= n; i++ {
+		err := db.Update(context.Background(), func(dbs *DBStructure) error {
+			dbs.PutUser(User{ID: fmt.Sprint(i), Email: fmt.Sprintf("user%d@example.com", i)})
+			return nil
+		})
+		assertNoError(t, err)
+	}
+}
+
+// crash stops db without the final flush Close does, as if the process died.
+func crash(t testing.TB, db *DB) {
+	t.Helper()
+
+	close(db.done)
+	<-db.stopped
+	if db.wal != nil {
+		assertNoError(t, db.wal.close())
+	}
+}
+
+func TestWALFailureHalfwayThroughAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+
+	db, err := New(path, Options{WAL: true})
+	assertNoError(t, err)
+	putUsers(t, db, 1)
+
+	errDiskFull := errors.New("no space left on device")
+	original := write
+	write = func(f *os.File, data []byte) (int, error) {
+		n, _ := f.Write(data[:len(data)/2])
+		return n, errDiskFull
+	}
+	err = db.Update(context.Background(), func(dbs *DBStructure) error {
+		dbs.PutUser(User{ID: "2", Email: "user2@example.com"})
+		return nil
+	})
+	write = original
+	if !errors.Is(err, errDiskFull) {
+		t.Fatalf("got: %v\nwant: %v", err, errDiskFull)
+	}
+	assertUsers(t, db, 1)
+
+	// The log must still be appendable and replayable after the failed write.
+	err = db.Update(context.Background(), func(dbs *DBStructure) error {
+		dbs.PutUser(User{ID: "3", Email: "user3@example.com"})
+		return nil
+	})
+	assertNoError(t, err)
+	crash(t, db)
+
+	db, err = New(path, Options{WAL: true})
+	assertNoError(t, err)
+	defer db.Close()
+	db.View(context.Background(), func(dbs *DBStructure) error {
+		if _, ok := dbs.Users["2"]; ok {
+			t.Errorf("replayed the transaction whose append failed")
+		}
+		if _, ok := dbs.Users["3"]; !ok {
+			t.Errorf("lost the transaction appended after the failed one")
+		}
+		return nil
+	})
+}
@@ -1,9 +1,13 @@
 package env
 
 import (
+	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,19 +19,54 @@ type Env struct {
 	DSN            string
 	JwtSecret      string
 	PolkaApiKey    string
+	// AdminApiKey authorizes the admin endpoints that expose the whole database. They are disabled when it is empty.
+	AdminApiKey string
+	// DBMode is how the JSON database persists writes: "snapshot" (the default) or "wal".
+	DBMode string
+	// FlushInterval is how often the JSON database writes its changes to disk. Zero, the default, writes and syncs
+	// every change before it is acknowledged; a positive interval trades the changes of the last interval for speed.
+	FlushInterval time.Duration
+	// DBReadTimeout and DBWriteTimeout bound how long a single read or write of the database may take.
+	// Zero does not bound it.
+	DBReadTimeout  time.Duration
+	DBWriteTimeout time.Duration
+	// ChirpRetention is how long deleted chirps can be restored before they are purged.
+	ChirpRetention time.Duration
+	// EventRetention is how long events are kept, at least. Events are kept longer while a subscriber has not processed them.
+	EventRetention time.Duration
+	// HandleChangeInterval is how long users must wait after changing their handle before they change it again.
+	HandleChangeInterval time.Duration
+	// PlusFoldingDomains are the email domains on which me+tag@domain is the same address as me@domain.
+	PlusFoldingDomains []string
+	// EncryptionKeys encrypt the JSON database.
+	EncryptionKeys EncryptionKeys
+
+	// ResetDB discards all existing data when the database is opened.
+	ResetDB bool
+	// RecoverDB starts with an empty database instead of refusing to start on a corrupt one.
+	RecoverDB bool
+}
+
+// EncryptionKeys are the keys of the JSON database.
+type EncryptionKeys struct {
+	// Key encrypts the database. The database is written in plaintext when it is nil.
+	Key []byte
+	// PreviousKeys only decrypt, so that the database can still be read after Key is rotated.
+	PreviousKeys [][]byte
 }
 
 // Load loads the environment variables into a struct.
 // If the server is run with a -local flag then the environment is loaded from a .env file using godotenv.
+// The -reset-db and -recover flags control how an existing database is opened.
 func Load() (*Env, error) {
 	local := flag.Bool("local", false, "Depend on the .env file for local development")
+	resetDB := flag.Bool("reset-db", false, "Discard all existing data in the database on startup")
+	recoverDB := flag.Bool("recover", false, "Move a corrupt database aside and start with an empty one")
 	flag.Parse()
 
-	if *local {
-		err := godotenv.Load()
-		if err != nil {
-			return nil, fmt.Errorf("failed to load environment from .env : %s", err)
-		}
+	err := loadDotEnv(*local)
+	if err != nil {
+		return nil, err
 	}
 
 	port, ok := os.LookupEnv("PORT")
@@ -55,15 +94,157 @@ func Load() (*Env, error) {
 		return nil, envNotFound("POLKA_API_KEY")
 	}
 
+	dbMode, ok := os.LookupEnv("DB_MODE")
+	if !ok {
+		dbMode = "snapshot"
+	}
+	if dbMode != "snapshot" && dbMode != "wal" {
+		return nil, fmt.Errorf("DB_MODE must be either \"snapshot\" or \"wal\", got %q", dbMode)
+	}
+
+	flushInterval, err := lookupDuration("FLUSH_INTERVAL", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	dbReadTimeout, err := lookupDuration("DB_READ_TIMEOUT", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	dbWriteTimeout, err := lookupDuration("DB_WRITE_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	chirpRetention, err := lookupDuration("CHIRP_RETENTION", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	eventRetention, err := lookupDuration("EVENT_RETENTION", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	handleChangeInterval, err := lookupDuration("HANDLE_CHANGE_INTERVAL", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	var plusFoldingDomains []string
+	if value, ok := os.LookupEnv("EMAIL_PLUS_FOLDING_DOMAINS"); ok && value != "" {
+		for _, domain := range strings.Split(value, ",") {
+			plusFoldingDomains = append(plusFoldingDomains, strings.TrimSpace(domain))
+		}
+	}
+
+	encryptionKeys, err := LoadEncryptionKeys()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Env{
-		Port:           port,
-		FileserverPath: fileserverPath,
-		DSN:            dsn,
-		JwtSecret:      jwtSecret,
-		PolkaApiKey:    polkaApiKey,
+		Port:                 port,
+		FileserverPath:       fileserverPath,
+		DSN:                  dsn,
+		JwtSecret:            jwtSecret,
+		PolkaApiKey:          polkaApiKey,
+		AdminApiKey:          os.Getenv("ADMIN_API_KEY"),
+		DBMode:               dbMode,
+		FlushInterval:        flushInterval,
+		DBReadTimeout:        dbReadTimeout,
+		DBWriteTimeout:       dbWriteTimeout,
+		ChirpRetention:       chirpRetention,
+		EventRetention:       eventRetention,
+		HandleChangeInterval: handleChangeInterval,
+		PlusFoldingDomains:   plusFoldingDomains,
+		EncryptionKeys:       encryptionKeys,
+		ResetDB:              *resetDB,
+		RecoverDB:            *recoverDB,
 	}, nil
 }
 
+// LoadDSN loads only the DSN, for the subcommands that work on the database without serving.
+// If local is set then the environment is loaded from a .env file using godotenv.
+func LoadDSN(local bool) (string, error) {
+	err := loadDotEnv(local)
+	if err != nil {
+		return "", err
+	}
+
+	dsn, ok := os.LookupEnv("DSN")
+	if !ok {
+		return "", envNotFound("DSN")
+	}
+	return dsn, nil
+}
+
+// LoadEncryptionKeys loads the keys of the JSON database from the environment, which must already be loaded.
+// The key is either DB_ENCRYPTION_KEY or the content of the file at DB_ENCRYPTION_KEY_FILE,
+// and DB_PREVIOUS_ENCRYPTION_KEYS is a comma separated list of the keys it replaced. Keys are base64 encoded.
+func LoadEncryptionKeys() (EncryptionKeys, error) {
+	keys := EncryptionKeys{}
+
+	value, ok := os.LookupEnv("DB_ENCRYPTION_KEY")
+	if path, isSet := os.LookupEnv("DB_ENCRYPTION_KEY_FILE"); isSet && path != "" {
+		if ok && value != "" {
+			return keys, errors.New("only one of DB_ENCRYPTION_KEY and DB_ENCRYPTION_KEY_FILE can be set")
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return keys, fmt.Errorf("failed to read DB_ENCRYPTION_KEY_FILE : %s", err)
+		}
+		value = string(data)
+	}
+
+	if value = strings.TrimSpace(value); value != "" {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return keys, fmt.Errorf("database encryption key is not valid base64 : %s", err)
+		}
+		keys.Key = key
+	}
+
+	if value, ok := os.LookupEnv("DB_PREVIOUS_ENCRYPTION_KEYS"); ok && value != "" {
+		for _, encoded := range strings.Split(value, ",") {
+			key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+			if err != nil {
+				return keys, fmt.Errorf("DB_PREVIOUS_ENCRYPTION_KEYS contains a key that is not valid base64 : %s", err)
+			}
+			keys.PreviousKeys = append(keys.PreviousKeys, key)
+		}
+	}
+	return keys, nil
+}
+
+func loadDotEnv(local bool) error {
+	if !local {
+		return nil
+	}
+
+	err := godotenv.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load environment from .env : %s", err)
+	}
+	return nil
+}
+
+// lookupDuration parses the environment variable name as a non-negative duration, or returns fallback if it is not set.
+func lookupDuration(name string, fallback time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration, got %q", name, value)
+	}
+	return d, nil
+}
+
 func envNotFound(name string) error {
 	return fmt.Errorf("%s environment variable is not set", name)
 }
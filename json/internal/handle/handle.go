@@ -0,0 +1,57 @@
+// Package handle validates the handles of users: the unique public names other users know them by.
+package handle
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	MinLength = 3
+	MaxLength = 15
+)
+
+// ErrInvalid is returned by Validate for handles users cannot take.
+var ErrInvalid = errors.New("invalid handle")
+
+// reserved are handles that would be confused with the endpoints or the staff of chirpy.
+var reserved = map[string]struct{}{
+	"admin":  {},
+	"api":    {},
+	"chirpy": {},
+	"me":     {},
+}
+
+// Normalize maps a handle received from a client, with or without its @, to the form it is stored under.
+// Handles are case insensitive.
+func Normalize(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+}
+
+// Validate checks that a normalized handle is MinLength to MaxLength lowercase ASCII letters, digits
+// and underscores, at least one of them a letter, and that it is not reserved. It fails with ErrInvalid.
+func Validate(handle string) error {
+	if len(handle) < MinLength || len(handle) > MaxLength {
+		return fmt.Errorf("%w : must be %d to %d characters long", ErrInvalid, MinLength, MaxLength)
+	}
+
+	hasLetter := false
+	for _, r := range handle {
+		switch {
+		case 'a' <= r && r <= 'z':
+			hasLetter = true
+		case '0' <= r && r <= '9', r == '_':
+		default:
+			return fmt.Errorf("%w : must only contain letters, digits and underscores", ErrInvalid)
+		}
+	}
+	if !hasLetter {
+		return fmt.Errorf("%w : must contain a letter", ErrInvalid)
+	}
+
+	if _, ok := reserved[handle]; ok {
+		return fmt.Errorf("%w : %q is reserved", ErrInvalid, handle)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package handle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		Desc   string
+		Handle string
+		Valid  bool
+	}{
+		{Desc: "letters", Handle: "zoumas", Valid: true},
+		{Desc: "digits and underscores", Handle: "chirp_2024", Valid: true},
+		{Desc: "shortest", Handle: "abc", Valid: true},
+		{Desc: "longest", Handle: "abcdefghijklmno", Valid: true},
+		{Desc: "too short", Handle: "ab"},
+		{Desc: "too long", Handle: "abcdefghijklmnop"},
+		{Desc: "digits only", Handle: "12345"},
+		{Desc: "uppercase", Handle: "Zoumas"},
+		{Desc: "punctuation", Handle: "zou.mas"},
+		{Desc: "non ASCII", Handle: "café"},
+		{Desc: "reserved", Handle: "admin"},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.Desc, func(t *testing.T) {
+			err := Validate(cs.Handle)
+			if cs.Valid && err != nil {
+				t.Errorf("got error %q, want none", err)
+			}
+			if !cs.Valid && !errors.Is(err, ErrInvalid) {
+				t.Errorf("got error %v, want %v", err, ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := Normalize(" @Zoumas "); got != "zoumas" {
+		t.Errorf("got %q, want %q", got, "zoumas")
+	}
+}
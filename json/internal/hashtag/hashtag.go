@@ -0,0 +1,51 @@
+// Package hashtag extracts the #tags of chirps.
+package hashtag
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Parse returns the hashtags of text, normalized and without duplicates, in the order they first appear.
+//
+// A hashtag is a # followed by letters, digits and underscores, at least one of them a letter,
+// that does not directly follow a letter, digit, underscore or another #: "#go #1 a#b ##c" only has "go".
+func Parse(text string) []string {
+	var tags []string
+	seen := map[string]struct{}{}
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' || (i > 0 && (isTagRune(runes[i-1]) || runes[i-1] == '#')) {
+			continue
+		}
+
+		end := i + 1
+		hasLetter := false
+		for end < len(runes) && isTagRune(runes[end]) {
+			hasLetter = hasLetter || unicode.IsLetter(runes[end])
+			end++
+		}
+		if !hasLetter || (end < len(runes) && runes[end] == '#') {
+			continue
+		}
+
+		tag := Normalize(string(runes[i+1 : end]))
+		if _, ok := seen[tag]; !ok {
+			seen[tag] = struct{}{}
+			tags = append(tags, tag)
+		}
+		i = end - 1
+	}
+	return tags
+}
+
+// Normalize maps a tag received from a client, with or without its #, to the form it is stored under.
+// Tags are case insensitive.
+func Normalize(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
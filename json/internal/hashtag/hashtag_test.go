@@ -0,0 +1,32 @@
+package hashtag
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		Desc string
+		Text string
+		Tags []string
+	}{
+		{Desc: "no tags", Text: "Hello, world", Tags: []string{}},
+		{Desc: "tags in order", Text: "#Go is fun, #rust too", Tags: []string{"go", "rust"}},
+		{Desc: "duplicates in any case", Text: "#go #GO #Go", Tags: []string{"go"}},
+		{Desc: "punctuation ends a tag", Text: "Love #golang! (#chirpy_red)", Tags: []string{"golang", "chirpy_red"}},
+		{Desc: "unicode", Text: "#café", Tags: []string{"café"}},
+		{Desc: "numbers only", Text: "#1 fan, #2024", Tags: []string{}},
+		{Desc: "inside words", Text: "a#b email@x.com#c", Tags: []string{}},
+		{Desc: "repeated #", Text: "##c #d#e", Tags: []string{}},
+		{Desc: "lone #", Text: "# and #", Tags: []string{}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.Desc, func(t *testing.T) {
+			if got := Parse(cs.Text); !slices.Equal(got, cs.Tags) {
+				t.Errorf("got: %q\nwant: %q", got, cs.Tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Package id issues the IDs of chirps and users.
+// IDs are ULIDs: globally unique strings that sort lexicographically by creation time,
+// so exports from different environments can be merged without collisions.
+package id
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	mu      sync.Mutex
+	entropy = ulid.Monotonic(rand.Reader, 0)
+)
+
+// New returns a new ID. IDs issued by the same process are strictly increasing.
+func New() string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return ulid.MustNew(ulid.Timestamp(time.Now()), entropy).String()
+}
+
+// Legacy returns the ID that replaces an integer ID from before IDs were ULIDs.
+// Legacy IDs have a zero timestamp, so they sort before every new ID and among themselves in their original order.
+func Legacy(n int) string {
+	u := ulid.ULID{}
+	binary.BigEndian.PutUint64(u[8:], uint64(n))
+	return u.String()
+}
+
+// Normalize maps an ID received from a client to the ID it is stored under.
+// Integer IDs issued before the migration to ULIDs keep working.
+func Normalize(s string) string {
+	n, err := strconv.Atoi(s)
+	if err == nil && n >= 0 {
+		return Legacy(n)
+	}
+	return s
+}
+
+// Time returns the creation time encoded in an ID.
+// It is the zero time.Time for legacy IDs and for strings that are not IDs.
+func Time(s string) time.Time {
+	u, err := ulid.ParseStrict(s)
+	if err != nil || u.Time() == 0 {
+		return time.Time{}
+	}
+	return ulid.Time(u.Time())
+}
+
+// Valid reports whether s is an ID, legacy IDs included.
+func Valid(s string) bool {
+	_, err := ulid.ParseStrict(s)
+	return err == nil
+}
@@ -0,0 +1,38 @@
+package id
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewIsSortedByCreation(t *testing.T) {
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = New()
+	}
+
+	if !slices.IsSorted(ids) {
+		t.Error("IDs do not sort in creation order")
+	}
+	if len(slices.Compact(slices.Clone(ids))) != len(ids) {
+		t.Error("IDs are not unique")
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	legacy := []string{Legacy(1), Legacy(2), Legacy(10), Legacy(300)}
+	if !slices.IsSorted(legacy) {
+		t.Errorf("legacy IDs do not keep their original order: %v", legacy)
+	}
+
+	if newID := New(); Legacy(1<<40) >= newID {
+		t.Errorf("legacy ID %s sorts after new ID %s", Legacy(1<<40), newID)
+	}
+
+	if got := Normalize("2"); got != Legacy(2) {
+		t.Errorf("got: %q\nwant: %q", got, Legacy(2))
+	}
+	if newID := New(); Normalize(newID) != newID {
+		t.Errorf("Normalize changed a ULID: %q", newID)
+	}
+}
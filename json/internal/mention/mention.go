@@ -0,0 +1,61 @@
+// Package mention extracts the @handle mentions of chirps.
+package mention
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zoumas/chirpy/json/internal/handle"
+)
+
+// A Match is an @handle found in a text.
+type Match struct {
+	// Handle is normalized and valid.
+	Handle string
+	// Start and End are the byte offsets of the match in the text, @ included: text[Start:End].
+	Start int
+	End   int
+}
+
+// Parse returns the mentions of text in the order they appear, one Match for every occurrence.
+//
+// A mention is an @ followed by a valid handle, as checked by handle.Validate, that does not directly follow
+// a letter, digit, underscore or another @, and is not directly followed by another @:
+// "@Bob me@bob.com @@bob @bob@example.com @b" only has "bob" once.
+func Parse(text string) []Match {
+	var matches []Match
+
+	for i := 0; i < len(text); i++ {
+		if text[i] != '@' {
+			continue
+		}
+		if previous, _ := utf8.DecodeLastRuneInString(text[:i]); i > 0 && (isHandleRune(previous) || previous == '@') {
+			continue
+		}
+
+		end := i + 1
+		for end < len(text) && isHandleByte(text[end]) {
+			end++
+		}
+		if end < len(text) && text[end] == '@' {
+			continue
+		}
+
+		name := handle.Normalize(text[i:end])
+		if handle.Validate(name) != nil {
+			continue
+		}
+		matches = append(matches, Match{Handle: name, Start: i, End: end})
+		i = end - 1
+	}
+	return matches
+}
+
+func isHandleRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// isHandleByte reports whether b can be part of a handle. Handles are ASCII, so bytes can be tested on their own.
+func isHandleByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '_'
+}
@@ -0,0 +1,43 @@
+package mention
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		Desc    string
+		Text    string
+		Matches []Match
+	}{
+		{Desc: "no mentions", Text: "Hello, world", Matches: nil},
+		{Desc: "mentions in order", Text: "@Alice and @bob_2", Matches: []Match{
+			{Handle: "alice", Start: 0, End: 6},
+			{Handle: "bob_2", Start: 11, End: 17},
+		}},
+		{Desc: "every occurrence", Text: "@bob @bob", Matches: []Match{
+			{Handle: "bob", Start: 0, End: 4},
+			{Handle: "bob", Start: 5, End: 9},
+		}},
+		{Desc: "punctuation ends a mention", Text: "hi @bob! (@carol)", Matches: []Match{
+			{Handle: "bob", Start: 3, End: 7},
+			{Handle: "carol", Start: 10, End: 16},
+		}},
+		{Desc: "byte offsets after multibyte runes", Text: "café @bob", Matches: []Match{
+			{Handle: "bob", Start: 6, End: 10},
+		}},
+		{Desc: "emails", Text: "me@bob.com @bob@example.com", Matches: nil},
+		{Desc: "after a letter", Text: "é@bob", Matches: nil},
+		{Desc: "repeated @", Text: "@@bob", Matches: nil},
+		{Desc: "invalid handles", Text: "@b @123 @me @averyveryverylonghandle @", Matches: nil},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.Desc, func(t *testing.T) {
+			if got := Parse(cs.Text); !slices.Equal(got, cs.Matches) {
+				t.Errorf("\ngot: %+v\nwant: %+v", got, cs.Matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+// Package search is a full-text search engine over short documents, kept in memory.
+// Documents are split into stemmed terms (see Tokenize) and stored in an inverted index,
+// which maps every term to the documents that contain it and the positions it appears at.
+package search
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// BM25 parameters: k1 bounds how much repeating a term raises the score, b how much longer documents are penalized.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Index is an inverted index of documents identified by IDs. It is safe for concurrent use.
+type Index struct {
+	mu sync.RWMutex
+	// postings maps a term to the documents that contain it, and those to the positions of the term in them.
+	postings map[string]map[string][]int
+	// docs maps the ID of a document to its terms, in order.
+	docs        map[string][]string
+	totalLength int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[string][]int),
+		docs:     make(map[string][]string),
+	}
+}
+
+// Put indexes text as the document id, replacing the previous version of the document if any.
+func (ix *Index) Put(id, text string) {
+	terms := Tokenize(text)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+	ix.docs[id] = terms
+	ix.totalLength += len(terms)
+	for position, term := range terms {
+		docs, ok := ix.postings[term]
+		if !ok {
+			docs = make(map[string][]int)
+			ix.postings[term] = docs
+		}
+		docs[id] = append(docs[id], position)
+	}
+}
+
+// ReplaceWith replaces the documents of ix with the documents of other, at once. other must not be used afterwards.
+func (ix *Index) ReplaceWith(other *Index) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.postings, ix.docs, ix.totalLength = other.postings, other.docs, other.totalLength
+}
+
+// Remove removes the document id from the index, if it is there.
+func (ix *Index) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id string) {
+	terms, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range terms {
+		delete(ix.postings[term], id)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	ix.totalLength -= len(terms)
+	delete(ix.docs, id)
+}
+
+// Len returns the number of documents in the index.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.docs)
+}
+
+// A Hit is a document that matches a query.
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// Search returns up to limit documents that match query, the most relevant first.
+// Relevance is the BM25 score of the terms of the query that are not negated.
+// Documents with the same score are sorted by descending ID, so the newest come first when IDs sort by creation time.
+func (ix *Index) Search(query Query, limit int) []Hit {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	matches := query.root.match(ix)
+	hits := make([]Hit, 0, len(matches))
+	for id := range matches {
+		hits = append(hits, Hit{ID: id, Score: ix.score(id, query.terms)})
+	}
+
+	slices.SortFunc(hits, func(a, b Hit) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return hits[:min(limit, len(hits))]
+}
+
+// score returns the BM25 score of the document id for terms.
+func (ix *Index) score(id string, terms []string) float64 {
+	n := float64(len(ix.docs))
+	averageLength := float64(ix.totalLength) / n
+	length := float64(len(ix.docs[id]))
+
+	score := 0.0
+	for _, term := range terms {
+		docs := ix.postings[term]
+		tf := float64(len(docs[id]))
+		if tf == 0 {
+			continue
+		}
+
+		df := float64(len(docs))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length/averageLength))
+	}
+	return score
+}
+
+// set is a set of document IDs.
+type set map[string]struct{}
+
+func (ix *Index) all() set {
+	s := make(set, len(ix.docs))
+	for id := range ix.docs {
+		s[id] = struct{}{}
+	}
+	return s
+}
+
+// node is a node of the syntax tree of a query.
+type node interface {
+	// match returns the documents of ix that match the node. ix must be locked.
+	match(ix *Index) set
+	// collectTerms calls fn with every term that is not negated.
+	collectTerms(fn func(term string))
+	write(b *strings.Builder)
+}
+
+type termNode string
+
+func (n termNode) match(ix *Index) set {
+	s := make(set, len(ix.postings[string(n)]))
+	for id := range ix.postings[string(n)] {
+		s[id] = struct{}{}
+	}
+	return s
+}
+
+func (n termNode) collectTerms(fn func(term string)) {
+	fn(string(n))
+}
+
+func (n termNode) write(b *strings.Builder) {
+	b.WriteString(string(n))
+}
+
+// phraseNode matches the documents that contain its terms next to each other, in order.
+type phraseNode []string
+
+func (n phraseNode) match(ix *Index) set {
+	s := set{}
+	for id, positions := range ix.postings[n[0]] {
+		for _, start := range positions {
+			if n.matchesAt(ix, id, start) {
+				s[id] = struct{}{}
+				break
+			}
+		}
+	}
+	return s
+}
+
+func (n phraseNode) matchesAt(ix *Index, id string, start int) bool {
+	for i, term := range n[1:] {
+		if _, ok := slices.BinarySearch(ix.postings[term][id], start+i+1); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (n phraseNode) collectTerms(fn func(term string)) {
+	for _, term := range n {
+		fn(term)
+	}
+}
+
+func (n phraseNode) write(b *strings.Builder) {
+	b.WriteString(`"` + strings.Join(n, " ") + `"`)
+}
+
+// andNode matches the documents that match all of its children. Negated children exclude documents instead.
+type andNode []node
+
+func (n andNode) match(ix *Index) set {
+	var s set
+	excluded := []set{}
+	for _, child := range n {
+		if not, ok := child.(notNode); ok {
+			excluded = append(excluded, not.child.match(ix))
+			continue
+		}
+
+		matches := child.match(ix)
+		if s == nil {
+			s = matches
+			continue
+		}
+		for id := range s {
+			if _, ok := matches[id]; !ok {
+				delete(s, id)
+			}
+		}
+	}
+
+	if s == nil {
+		s = ix.all()
+	}
+	for _, matches := range excluded {
+		for id := range matches {
+			delete(s, id)
+		}
+	}
+	return s
+}
+
+func (n andNode) collectTerms(fn func(term string)) {
+	for _, child := range n {
+		child.collectTerms(fn)
+	}
+}
+
+func (n andNode) write(b *strings.Builder) {
+	writeGroup(b, []node(n), " AND ")
+}
+
+// orNode matches the documents that match any of its children.
+type orNode []node
+
+func (n orNode) match(ix *Index) set {
+	s := set{}
+	for _, child := range n {
+		for id := range child.match(ix) {
+			s[id] = struct{}{}
+		}
+	}
+	return s
+}
+
+func (n orNode) collectTerms(fn func(term string)) {
+	for _, child := range n {
+		child.collectTerms(fn)
+	}
+}
+
+func (n orNode) write(b *strings.Builder) {
+	writeGroup(b, []node(n), " OR ")
+}
+
+// notNode matches the documents that do not match its child.
+type notNode struct {
+	child node
+}
+
+func (n notNode) match(ix *Index) set {
+	s := ix.all()
+	for id := range n.child.match(ix) {
+		delete(s, id)
+	}
+	return s
+}
+
+func (n notNode) collectTerms(func(term string)) {}
+
+func (n notNode) write(b *strings.Builder) {
+	b.WriteString("NOT ")
+	n.child.write(b)
+}
+
+func writeGroup(b *strings.Builder, children []node, operator string) {
+	b.WriteString("(")
+	for i, child := range children {
+		if i > 0 {
+			b.WriteString(operator)
+		}
+		child.write(b)
+	}
+	b.WriteString(")")
+}
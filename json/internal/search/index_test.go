@@ -0,0 +1,85 @@
+package search
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	cases := []struct {
+		Query string
+		Want  string
+	}{
+		{Query: "cats", Want: "cat"},
+		{Query: "cats dogs", Want: "(cat AND dog)"},
+		{Query: "cats AND dogs OR birds", Want: "((cat AND dog) OR bird)"},
+		{Query: "cats (dogs OR birds)", Want: "(cat AND (dog OR bird))"},
+		{Query: `"running dogs" -cats`, Want: `("run dog" AND NOT cat)`},
+		{Query: "NOT e-mail", Want: `NOT "e mail"`},
+		{Query: "cats and dogs", Want: "(cat AND and AND dog)"},
+		{Query: `cats ! "unterminated phrase`, Want: `(cat AND "untermin phrase")`},
+	}
+	for _, cs := range cases {
+		query, err := ParseQuery(cs.Query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) : %s", cs.Query, err)
+			continue
+		}
+		if got := query.String(); got != cs.Want {
+			t.Errorf("ParseQuery(%q) = %s, want %s", cs.Query, got, cs.Want)
+		}
+	}
+
+	for _, q := range []string{"", "!?", "cats OR", "(cats", "cats)", "NOT"} {
+		_, err := ParseQuery(q)
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("ParseQuery(%q) : got error %v, want %s", q, err, ErrInvalidQuery)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ix := NewIndex()
+	ix.Put("1", "My dog chases cats")
+	ix.Put("2", "Cats, cats, cats: a cat person's diary")
+	ix.Put("3", "My cat chased dogs")
+	ix.Put("4", "Birds are better than dogs")
+	ix.Put("5", "Nothing to see here")
+	ix.Put("5", "Dogs chasing birds")
+	ix.Put("6", "Deleted cat")
+	ix.Remove("6")
+
+	cases := []struct {
+		Query string
+		Want  []string
+	}{
+		// 1 and 3 are as relevant: the newest comes first.
+		{Query: "cat", Want: []string{"2", "3", "1"}},
+		{Query: "dog chase", Want: []string{"5", "3", "1"}},
+		{Query: `"chasing cats"`, Want: []string{"1"}},
+		{Query: "dogs -cats", Want: []string{"5", "4"}},
+		{Query: "birds OR diary", Want: []string{"2", "5", "4"}},
+		{Query: "NOT (cat OR dog)", Want: []string{}},
+		{Query: "nothing", Want: []string{}},
+	}
+	for _, cs := range cases {
+		query, err := ParseQuery(cs.Query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) : %s", cs.Query, err)
+		}
+
+		got := []string{}
+		for _, hit := range ix.Search(query, 10) {
+			got = append(got, hit.ID)
+		}
+		if !slices.Equal(got, cs.Want) {
+			t.Errorf("%s : got %v, want %v", cs.Query, got, cs.Want)
+		}
+	}
+
+	query, _ := ParseQuery("dog")
+	if hits := ix.Search(query, 2); len(hits) != 2 {
+		t.Errorf("got %d hits, want 2", len(hits))
+	}
+}
@@ -0,0 +1,243 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidQuery is returned for queries that cannot be parsed, or that contain no term.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// A Query is a parsed search query.
+//
+// Words match the chirps that contain them, in any form: "running" matches "runs". Words separated by spaces
+// must all match, "a OR b" matches either, and "NOT a" or "-a" excludes the chirps that match. Operators are
+// uppercase. Text between double quotes matches as a phrase: its words in that order. Parentheses group.
+type Query struct {
+	root node
+	// terms are the terms that make a chirp relevant: the ones that are not negated.
+	terms []string
+}
+
+// ParseQuery parses q. It fails with ErrInvalidQuery.
+func ParseQuery(q string) (Query, error) {
+	p := &parser{tokens: lex(q)}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("%w : unexpected %q", ErrInvalidQuery, p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return Query{}, err
+	}
+	if root == nil {
+		return Query{}, fmt.Errorf("%w : no terms to search for", ErrInvalidQuery)
+	}
+
+	query := Query{root: root}
+	seen := map[string]struct{}{}
+	root.collectTerms(func(term string) {
+		if _, ok := seen[term]; !ok {
+			seen[term] = struct{}{}
+			query.terms = append(query.terms, term)
+		}
+	})
+	return query, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPhrase
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lex splits a query into tokens. An unterminated phrase runs to the end of the query.
+func lex(q string) []token {
+	tokens := []token{}
+	runes := []rune(q)
+	isDelimiter := func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")"})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenPhrase, text: string(runes[i+1 : end])})
+			i = end + 1
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, token{kind: tokenNot, text: "-"})
+			i++
+		default:
+			end := i
+			for end < len(runes) && !isDelimiter(runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			switch word {
+			case "AND":
+				tokens = append(tokens, token{kind: tokenAnd, text: word})
+			case "OR":
+				tokens = append(tokens, token{kind: tokenOr, text: word})
+			case "NOT":
+				tokens = append(tokens, token{kind: tokenNot, text: word})
+			default:
+				tokens = append(tokens, token{kind: tokenWord, text: word})
+			}
+			i = end
+		}
+	}
+	return tokens
+}
+
+// parser is a recursive descent parser over the tokens of a query:
+//
+//	or      = and { "OR" and }
+//	and     = unary { [ "AND" ] unary }
+//	unary   = ( "NOT" | "-" ) unary | primary
+//	primary = "(" or ")" | phrase | word
+//
+// Words and phrases without any term, such as punctuation, parse to a nil node and are left out.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (tokenKind, bool) {
+	if p.pos >= len(p.tokens) {
+		return 0, false
+	}
+	return p.tokens[p.pos].kind, true
+}
+
+func (p *parser) parseOr() (node, error) {
+	children := []node{}
+	for {
+		child, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if child != nil {
+			children = append(children, child)
+		}
+
+		if kind, ok := p.peek(); !ok || kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+
+	switch len(children) {
+	case 0:
+		return nil, nil
+	case 1:
+		return children[0], nil
+	}
+	return orNode(children), nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	children := []node{}
+	for {
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if child != nil {
+			children = append(children, child)
+		}
+
+		kind, ok := p.peek()
+		if ok && kind == tokenAnd {
+			p.pos++
+			continue
+		}
+		if !ok || (kind != tokenWord && kind != tokenPhrase && kind != tokenNot && kind != tokenOpen) {
+			break
+		}
+	}
+
+	switch len(children) {
+	case 0:
+		return nil, nil
+	case 1:
+		return children[0], nil
+	}
+	return andNode(children), nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if kind, ok := p.peek(); ok && kind == tokenNot {
+		p.pos++
+		child, err := p.parseUnary()
+		if child == nil || err != nil {
+			return nil, err
+		}
+		return notNode{child}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	kind, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w : unexpected end of query", ErrInvalidQuery)
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+
+	switch kind {
+	case tokenOpen:
+		child, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if kind, ok := p.peek(); !ok || kind != tokenClose {
+			return nil, fmt.Errorf("%w : missing %q", ErrInvalidQuery, ")")
+		}
+		p.pos++
+		return child, nil
+	case tokenWord, tokenPhrase:
+		// A word can hold several terms, as in "e-mail": it matches them as a phrase.
+		terms := Tokenize(t.text)
+		switch len(terms) {
+		case 0:
+			return nil, nil
+		case 1:
+			return termNode(terms[0]), nil
+		}
+		return phraseNode(terms), nil
+	}
+	return nil, fmt.Errorf("%w : unexpected %q", ErrInvalidQuery, t.text)
+}
+
+// String returns the query in a normalized form, for debugging.
+func (q Query) String() string {
+	b := strings.Builder{}
+	q.root.write(&b)
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package search
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	// From the vocabulary of the reference implementation.
+	cases := map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"ties":           "ti",
+		"cats":           "cat",
+		"feed":           "feed",
+		"agreed":         "agre",
+		"plastered":      "plaster",
+		"motoring":       "motor",
+		"sing":           "sing",
+		"conflated":      "conflat",
+		"troubled":       "troubl",
+		"sized":          "size",
+		"hopping":        "hop",
+		"tanned":         "tan",
+		"falling":        "fall",
+		"hissing":        "hiss",
+		"fizzed":         "fizz",
+		"failing":        "fail",
+		"filing":         "file",
+		"happy":          "happi",
+		"sky":            "sky",
+		"relational":     "relat",
+		"conditional":    "condit",
+		"rational":       "ration",
+		"generalization": "gener",
+		"oscillators":    "oscil",
+		"connections":    "connect",
+		"running":        "run",
+		"adjustable":     "adjust",
+		"controlling":    "control",
+		"roll":           "roll",
+		"probate":        "probat",
+		"rate":           "rate",
+		"is":             "is",
+		"café":           "café",
+		"r2d2":           "r2d2",
+	}
+
+	for word, want := range cases {
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Don't PANIC: the Connections are running—fine!")
+	want := []string{"dont", "panic", "the", "connect", "ar", "run", "fine"}
+	if len(got) != len(want) {
+		t.Fatalf("got: %q\nwant: %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got: %q\nwant: %q", got, want)
+		}
+	}
+}
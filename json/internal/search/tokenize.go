@@ -0,0 +1,31 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text into the terms it is indexed and searched under: lowercase, stemmed words.
+// Words are runs of letters and digits; apostrophes inside them are dropped, so "don't" is a single word.
+func Tokenize(text string) []string {
+	terms := []string{}
+	word := strings.Builder{}
+	flush := func() {
+		if word.Len() > 0 {
+			terms = append(terms, Stem(word.String()))
+			word.Reset()
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(unicode.ToLower(r))
+		case (r == '\'' || r == '’') && word.Len() > 0:
+		default:
+			flush()
+		}
+	}
+	flush()
+	return terms
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/zoumas/chirpy/json/internal/app"
 	"github.com/zoumas/chirpy/json/internal/database"
@@ -9,16 +11,47 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			err := Migrate(os.Args[2:])
+			if err != nil {
+				log.Fatalf("failed to migrate database : %s", err)
+			}
+			return
+		case "restore":
+			err := Restore(os.Args[2:])
+			if err != nil {
+				log.Fatalf("failed to restore database : %s", err)
+			}
+			return
+		}
+	}
+
 	env, err := env.Load()
 	if err != nil {
 		log.Fatalf("failed to load configuration : %s", err)
 	}
-	db, err := database.New(env.DSN)
+
+	app, err := app.New(env)
 	if err != nil {
 		log.Fatalf("failed to connect to database : %s", err)
 	}
 
-	app := app.New(env, db)
 	server := ConfiguredServer(app)
 	app.Run(server)
 }
+
+// loadKeyring loads the keys of the JSON database for the subcommands. The environment must already be loaded.
+func loadKeyring() (*database.Keyring, error) {
+	keys, err := env.LoadEncryptionKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	keyring, err := database.NewKeyring(keys.Key, keys.PreviousKeys...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database encryption key : %s", err)
+	}
+	return keyring, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/env"
+)
+
+// Migrate implements the migrate subcommand, which upgrades the database selected by DSN to the current schema.
+// The database is backed up before it is rewritten.
+func Migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	local := flags.Bool("local", false, "Depend on the .env file for local development")
+	dryRun := flags.Bool("dry-run", false, "Report the pending migrations without changing the database")
+	flags.Parse(args)
+
+	dsn, err := env.LoadDSN(*local)
+	if err != nil {
+		return err
+	}
+	driver, path, err := database.ParseDSN(dsn)
+	if err != nil {
+		return err
+	}
+	keys, err := loadKeyring()
+	if err != nil {
+		return err
+	}
+
+	type migration struct {
+		version     int
+		description string
+	}
+	var migrations []migration
+	var backupPath string
+
+	switch driver {
+	case database.DriverMemory:
+		return errors.New("an in-memory database has nothing to migrate")
+	case database.DriverSQLite:
+		var applied []database.SQLiteMigration
+		applied, backupPath, err = database.MigrateSQLite(path, *dryRun)
+		for _, m := range applied {
+			migrations = append(migrations, migration{m.Version, m.Description})
+		}
+	default:
+		var applied []database.Migration
+		applied, backupPath, err = database.Migrate(path, keys, *dryRun)
+		for _, m := range applied {
+			migrations = append(migrations, migration{m.Version, m.Description})
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(migrations) == 0 {
+		log.Printf("%s is up to date", path)
+		return nil
+	}
+
+	verb := "applied"
+	if *dryRun {
+		verb = "would apply"
+	}
+	for _, m := range migrations {
+		fmt.Printf("%s migration %d : %s\n", verb, m.version, m.description)
+	}
+	if backupPath != "" {
+		log.Printf("backed up %s to %s", path, backupPath)
+	}
+	return nil
+}
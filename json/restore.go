@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/zoumas/chirpy/json/internal/database"
+	"github.com/zoumas/chirpy/json/internal/env"
+)
+
+// Restore implements the restore subcommand, which replaces the database selected by DSN with a snapshot
+// downloaded from /admin/backup. The server must be stopped; a running server restores through /admin/restore.
+func Restore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	local := flags.Bool("local", false, "Depend on the .env file for local development")
+	flags.Usage = func() {
+		log.Printf("usage: chirpy restore [-local] <snapshot.json.gz>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("missing snapshot")
+	}
+
+	dsn, err := env.LoadDSN(*local)
+	if err != nil {
+		return err
+	}
+	driver, path, err := database.ParseDSN(dsn)
+	if err != nil {
+		return err
+	}
+	keys, err := loadKeyring()
+	if err != nil {
+		return err
+	}
+	if driver != database.DriverJSON {
+		return errors.New("restoring is only supported by the JSON database")
+	}
+
+	snapshot, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+
+	err = database.RestoreFile(path, keys, snapshot)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("restored %s from %s", path, flags.Arg(0))
+	return nil
+}
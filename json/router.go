@@ -24,6 +24,7 @@ func ConfiguredRouter(app *app.App) *chi.Mux {
 			http.MethodPut,
 			http.MethodDelete,
 		},
+		ExposedHeaders: []string{"ETag", "Link"},
 	}))
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
@@ -48,12 +49,21 @@ func ConfiguredApiRouter(app *app.App) *chi.Mux {
 
 	router.Post("/chirps", app.WithAccessToken(app.CreateChirp))
 	router.Get("/chirps", app.GetAllChirps)
+	router.Get("/chirps/search", app.SearchChirps)
 	router.Get("/chirps/{id}", app.GetChirpByID)
 	router.Delete("/chirps/{id}", app.WithAccessToken(app.DeleteChirp))
+	router.Post("/chirps/{id}/restore", app.WithAccessToken(app.RestoreChirp))
+
+	router.Get("/hashtags/trending", app.TrendingHashtags)
+	router.Get("/hashtags/{tag}/chirps", app.GetChirpsByHashtag)
 
 	router.Post("/login", app.Login)
 	router.Post("/users", app.CreateUser)
 	router.Put("/users", app.WithAccessToken(app.UpdateUser))
+	router.Get("/users/me/mentions", app.WithAccessToken(app.GetMentions))
+	router.Get("/users/{handle}", app.GetUserProfile)
+	router.Post("/users/{handle}/follow", app.WithAccessToken(app.FollowUser))
+	router.Delete("/users/{handle}/follow", app.WithAccessToken(app.UnfollowUser))
 
 	router.Post("/revoke", app.WithRefreshToken(app.Revoke))
 	router.Post("/refresh", app.WithRefreshToken(app.Refresh))
@@ -79,6 +89,12 @@ func ConfiguredAdminRouter(app *app.App) *chi.Mux {
 	router := chi.NewRouter()
 
 	router.Get("/metrics", app.ReportMetrics)
+	router.Get("/backup", app.WithAdminApiKey(app.Backup))
+	router.Post("/restore", app.WithAdminApiKey(app.Restore))
+
+	router.Get("/export/users", app.WithAdminApiKey(app.ExportUsers))
+	router.Get("/export/chirps", app.WithAdminApiKey(app.ExportChirps))
+	router.Post("/import", app.WithAdminApiKey(app.Import))
 
 	return router
 }